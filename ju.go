@@ -16,7 +16,7 @@ import (
 // noinspection GoUnusedExportedFunction
 func LogErrorTrace(err error, skip int) bool {
 	if err != nil {
-		logColor(skip+3, "red", "", err.Error())
+		logError(skip+3, "", err)
 		return true
 	}
 	return false
@@ -28,7 +28,7 @@ func LogErrorTrace(err error, skip int) bool {
 // noinspection GoUnusedExportedFunction
 func LogErrorTraceTo(name string, err error, skip int) bool {
 	if err != nil {
-		logColor(skip+3, "red", name, err.Error())
+		logError(skip+3, name, err)
 		return true
 	}
 	return false
@@ -48,14 +48,14 @@ func OutputErrorTrace(err error, skip int) bool {
 // noinspection GoUnusedExportedFunction
 func LogError(err error) {
 	if err != nil {
-		logColor(3, "red", "", err.Error())
+		logError(3, "", err)
 	}
 }
 
 // noinspection GoUnusedExportedFunction
 func LogErrorTo(name string, err error) {
 	if err != nil {
-		logColor(3, "red", name, err.Error())
+		logError(3, name, err)
 	}
 }
 
@@ -64,7 +64,7 @@ func LogErrorTo(name string, err error) {
 // noinspection GoUnusedExportedFunction
 func LogSucceed(err error) bool {
 	if err != nil {
-		logColor(3, "red", "", err.Error())
+		logError(3, "", err)
 		return false
 	}
 	return true
@@ -75,7 +75,7 @@ func LogSucceed(err error) bool {
 // noinspection GoUnusedExportedFunction
 func LogFail(err error) bool {
 	if err != nil {
-		logColor(3, "red", "", err.Error())
+		logError(3, "", err)
 		return true
 	}
 	return false
@@ -84,7 +84,7 @@ func LogFail(err error) bool {
 // noinspection GoUnusedExportedFunction
 func CheckSucceedTo(name string, err error) bool {
 	if err != nil {
-		logColor(3, "red", "", err.Error())
+		logError(3, "", err)
 		return false
 	}
 	return true
@@ -93,7 +93,7 @@ func CheckSucceedTo(name string, err error) bool {
 // noinspection GoUnusedExportedFunction
 func CheckFailTo(name string, err error) bool {
 	if err != nil {
-		logColor(3, "red", "", err.Error())
+		logError(3, "", err)
 		return true
 	}
 	return false
@@ -2,7 +2,6 @@ package ju
 
 import (
 	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/gookit/color"
@@ -20,47 +19,33 @@ const (
 )
 
 var _logMutex sync.Mutex
-var logParam = struct {
-	db              LogDb
-	output          bool
-	maxLogCount     int64
-	maxMainLogCount int64
-}{output: true, maxLogCount: 1000, maxMainLogCount: 10000}
 
 // SetLogParam 设置 Log 类函数的参数和表现，如果想让日志存储到数据，则设置一个有效的 db 对象
 // output 指示 Log 函数是否输出到控制台，默认这个值是 true
-// 注意：这个函数没有同步控制，也就是在并发调用 Log 类函数的时候，调用这个函数可能引发问题，所以一般在应用初始化时设置
+// 这个函数设置的是 DefaultLogger 返回的缺省 Logger，可以在记录日志的同时调用，需要独立的日志设置时使用 NewLogger。
 // Log 类函数会同步输出到控制台，或者存储到数据库（没有同步），在高性能和高并发场合这个可能成为主要的性能瓶颈。
-// maxLogCount,maxMainLogCount 分别是数据库存储日志的最大条数，默认分别是 1000 和 10000，如果日志数量达到这个数值，
-// 后续的日志会替换掉同 tag 最早的日志，maxLogCount 是 tag 不为空串的日志上限，maxMainLogCount 是 tag 为空串的
-// 日志的上限，tag 为空串的日志成为缺省日志。
+// maxLogCount,maxMainLogCount 分别是数据库存储日志的最大条数，默认分别是 1000 和 10000，如果日志数量超过这个数值，
+// 同 tag 最早的日志会被成批删除，maxLogCount 是 tag 不为空串的日志上限，maxMainLogCount 是 tag 为空串的
+// 日志的上限，tag 为空串的日志成为缺省日志。某个 tag 需要不同的上限或者按时间保留时，使用数据库日志对象的 SetTagRetention。
 // 如果这两个值设置 <= 0 则日志无上限。
 func SetLogParam(db LogDb, output bool, maxLogCount, maxMainLogCount int64) {
-	logParam.db = db
-	logParam.output = output
-	logParam.maxLogCount = maxLogCount
-	logParam.maxMainLogCount = maxMainLogCount
+	std().SetParam(db, output, maxLogCount, maxMainLogCount)
+}
+
+// SetLogConsoleFormat 设置 Log 类函数在控制台输出的格式，缺省是 LogFormatTab，也就是带颜色的 "时间 trace 日志" 格式，
+// LogFormatJson 和 LogFormatLogfmt 格式输出的是不带颜色的完整日志行，便于日志收集程序处理。
+// 这个设置不影响 OutputColor 类函数，它们总是使用缺省格式。
+func SetLogConsoleFormat(format LogFormat) {
+	std().SetConsoleFormat(format)
 }
 
 type ColorPrint func(format string, a ...interface{})
 
-// OutputColor 这个函数输出效果和logColor相同，但是只输出到控制台，任何时候都不会保存到数据库
+// OutputColor 这个函数输出效果和logColor相同，但是只输出到控制台，任何时候都不会保存到数据库，
+// 控制台的设置（SetLogConsoleWriter, SetLogColorMode, SetLogConsolePrefix）和缺省 Logger 相同
 // skip: 0 是OutputColor的调用位置, 1 是上一级函数的调用位置
 func OutputColor(skip int, color string, v ...interface{}) {
-	trace := GetTrace(skip + 2)
-	var builder strings.Builder
-	for i, value := range v {
-		if i > 0 {
-			builder.WriteString(" ")
-		}
-		builder.WriteString(fmt.Sprint(value))
-	}
-	str := builder.String()
-	cp := GetColorPrint(color)
-	_logMutex.Lock()
-	defer _logMutex.Unlock()
-	fmt.Print(GetNowTimeMs(), " ", trace, " ")
-	cp("%s\n", str)
+	outputColor(GetTrace(skip+2), color, logMessage(v), true)
 }
 func GetColorPrint(c string) (cp ColorPrint) {
 	switch c {
@@ -83,95 +68,81 @@ func GetColorPrint(c string) (cp ColorPrint) {
 	}
 	return color.Gray.Printf
 }
-func logColor(skip int, color, tag string, v ...interface{}) {
-	trace := GetTrace(skip)
-	var builder strings.Builder
-	for i, value := range v {
-		if i > 0 {
-			builder.WriteString(" ")
-		}
-		builder.WriteString(fmt.Sprint(value))
-	}
-	str := builder.String()
-
-	if logParam.db != nil {
-		logParam.db.saveLog(tag, color, trace, str)
-	}
-	if logParam.output {
-		cp := GetColorPrint(color)
+func logColor(skip int, level LogLevel, color, tag string, v ...interface{}) {
+	logFields(skip+1, level, color, tag, nil, v...)
+}
 
-		_logMutex.Lock()
-		defer _logMutex.Unlock()
-		fmt.Print(GetNowTimeMs(), " ", trace, " ")
-		cp("%s\n", str)
-	}
+// logFields 是所有 Log 类函数的最终实现，fields 是附加在日志上的结构化字段，可以是 nil
+func logFields(skip int, level LogLevel, color, tag string, fields JsonObject, v ...interface{}) {
+	std().logStack(skip+1, false, nil, level, color, tag, fields, v...)
 }
 
 // LogColor 以指定颜色输出，skip = 0 标记当前位置，skip = 1 标记上级函数调用位置，以此类推
 // 这个函数和其它 Log 颜色函数功能相同，但是多了一个 color 参数，并且可以设置记录位置。
+// 颜色类函数的日志级别由颜色决定，红色是 LevelError，黄色是 LevelWarn，其它颜色是 LevelInfo。
 func LogColor(skip int, color string, v ...interface{}) {
-	logColor(3+skip, color, "", v...)
+	logColor(3+skip, colorLevel(color), color, "", v...)
 }
 func LogColorTo(skip int, color, tag string, v ...interface{}) {
-	logColor(3+skip, color, tag, v...)
+	logColor(3+skip, colorLevel(color), color, tag, v...)
+}
+
+// LogLevelTo 以指定级别记录日志，颜色使用 LevelColor 返回的级别缺省颜色，skip 的含义和 LogColor 相同
+// noinspection GoUnusedExportedFunction
+func LogLevelTo(skip int, level LogLevel, tag string, v ...interface{}) {
+	logColor(3+skip, level, LevelColor(level), tag, v...)
 }
 
 // noinspection GoUnusedExportedFunction
-func LogBlack(a ...interface{}) { logColor(3, "black", "", a...) }
+func LogBlack(a ...interface{}) { logColor(3, LevelInfo, "black", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogRed(a ...interface{}) { logColor(3, "red", "", a...) }
+func LogRed(a ...interface{}) { logColor(3, LevelError, "red", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogGreen(a ...interface{}) { logColor(3, "green", "", a...) }
+func LogGreen(a ...interface{}) { logColor(3, LevelInfo, "green", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogYellow(a ...interface{}) { logColor(3, "yellow", "", a...) }
+func LogYellow(a ...interface{}) { logColor(3, LevelWarn, "yellow", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogBlue(a ...interface{}) { logColor(3, "blue", "", a...) }
+func LogBlue(a ...interface{}) { logColor(3, LevelInfo, "blue", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogMagenta(a ...interface{}) { logColor(3, "magenta", "", a...) }
+func LogMagenta(a ...interface{}) { logColor(3, LevelInfo, "magenta", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogCyan(a ...interface{}) { logColor(3, "cyan", "", a...) }
+func LogCyan(a ...interface{}) { logColor(3, LevelInfo, "cyan", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogWhite(a ...interface{}) { logColor(3, "white", "", a...) }
+func LogWhite(a ...interface{}) { logColor(3, LevelInfo, "white", "", a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogMagentaTo(tag string, a ...interface{}) { logColor(3, "magenta", tag, a...) }
+func LogMagentaTo(tag string, a ...interface{}) { logColor(3, LevelInfo, "magenta", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogCyanTo(tag string, a ...interface{}) { logColor(3, "cyan", tag, a...) }
+func LogCyanTo(tag string, a ...interface{}) { logColor(3, LevelInfo, "cyan", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogWhiteTo(tag string, a ...interface{}) { logColor(3, "white", tag, a...) }
+func LogWhiteTo(tag string, a ...interface{}) { logColor(3, LevelInfo, "white", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogBlackTo(tag string, a ...interface{}) { logColor(3, "black", tag, a...) }
+func LogBlackTo(tag string, a ...interface{}) { logColor(3, LevelInfo, "black", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogRedTo(tag string, a ...interface{}) { logColor(3, "red", tag, a...) }
+func LogRedTo(tag string, a ...interface{}) { logColor(3, LevelError, "red", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogGreenTo(tag string, a ...interface{}) { logColor(3, "green", tag, a...) }
+func LogGreenTo(tag string, a ...interface{}) { logColor(3, LevelInfo, "green", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogYellowTo(tag string, a ...interface{}) { logColor(3, "yellow", tag, a...) }
+func LogYellowTo(tag string, a ...interface{}) { logColor(3, LevelWarn, "yellow", tag, a...) }
 
 // noinspection GoUnusedExportedFunction
-func LogBlueTo(tag string, a ...interface{}) { logColor(3, "blue", tag, a...) }
+func LogBlueTo(tag string, a ...interface{}) { logColor(3, LevelInfo, "blue", tag, a...) }
 
 func outputColorF(skip int, color, format string, v ...interface{}) {
-	trace := GetTrace(skip)
-	cp := GetColorPrint(color)
-
-	_logMutex.Lock()
-	defer _logMutex.Unlock()
-	fmt.Print(GetNowTimeMs(), " ", trace, " ")
-	cp(format, v...)
+	outputColor(GetTrace(skip), color, fmt.Sprintf(format, v...), false)
 }
 
 // noinspection GoUnusedExportedFunction
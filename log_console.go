@@ -0,0 +1,160 @@
+package ju
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogColorMode 控制控制台输出是否带颜色
+type LogColorMode int
+
+const (
+	// LogColorAuto 是缺省值，输出到终端并且没有设置环境变量 NO_COLOR 时带颜色，输出到文件、管道或者其它 io.Writer 时不带颜色
+	LogColorAuto LogColorMode = iota
+	// LogColorAlways 总是带颜色
+	LogColorAlways
+	// LogColorNever 总是不带颜色
+	LogColorNever
+)
+
+// LogPrefixFunc 生成控制台输出中日志内容之前的部分，缺省是 "15:04:05.000 trace "。
+// li 中只有 CreatedAt, Level, Color, Trace, Tag 是可用的，返回值中可以使用颜色以外的任何内容
+type LogPrefixFunc func(li *LogInfo) string
+
+// defaultLogPrefix 输出时间（不带日期）和 trace
+func defaultLogPrefix(li *LogInfo) string {
+	return li.CreatedAt[11:] + " " + li.Trace + " "
+}
+
+// ansiColors 是颜色对应的 ANSI 前景色代码，不能识别的颜色使用灰色
+var ansiColors = map[string]string{
+	ColorBlack:   "30",
+	ColorRed:     "31",
+	ColorGreen:   "32",
+	ColorYellow:  "33",
+	ColorBlue:    "34",
+	ColorMagenta: "35",
+	ColorCyan:    "36",
+	ColorWhite:   "37",
+	ColorGray:    "90",
+}
+
+// SetLogConsoleWriter 设置缺省 Logger 和 OutputColor 类函数的控制台输出，w 为 nil 时恢复为 os.Stdout，
+// 比如输出到 os.Stderr，或者测试时输出到 bytes.Buffer
+// noinspection GoUnusedExportedFunction
+func SetLogConsoleWriter(w io.Writer) {
+	std().SetConsoleWriter(w)
+}
+
+// SetLogColorMode 设置缺省 Logger 和 OutputColor 类函数的控制台输出是否带颜色
+// noinspection GoUnusedExportedFunction
+func SetLogColorMode(mode LogColorMode) {
+	std().SetColorMode(mode)
+}
+
+// SetLogConsolePrefix 设置缺省 Logger 和 OutputColor 类函数的控制台输出中日志内容之前的部分，fn 为 nil 时恢复缺省格式
+// noinspection GoUnusedExportedFunction
+func SetLogConsolePrefix(fn LogPrefixFunc) {
+	std().SetConsolePrefix(fn)
+}
+
+// SetConsoleWriter 设置控制台输出，w 为 nil 时恢复为 os.Stdout
+func (l *Logger) SetConsoleWriter(w io.Writer) {
+	l.update(func(c *loggerConfig) {
+		c.writer = w
+	})
+}
+
+// SetColorMode 设置控制台输出是否带颜色
+func (l *Logger) SetColorMode(mode LogColorMode) {
+	l.update(func(c *loggerConfig) {
+		c.colorMode = mode
+	})
+}
+
+// SetConsolePrefix 设置控制台输出中日志内容之前的部分，fn 为 nil 时恢复缺省格式
+func (l *Logger) SetConsolePrefix(fn LogPrefixFunc) {
+	l.update(func(c *loggerConfig) {
+		c.prefix = fn
+	})
+}
+
+// consoleWriter 返回控制台输出，没有设置时是 os.Stdout
+func (c *loggerConfig) consoleWriter() io.Writer {
+	if c.writer == nil {
+		return os.Stdout
+	}
+	return c.writer
+}
+
+// useColor 根据 colorMode 和输出判断是否使用颜色，在修改设置时计算一次
+func (c *loggerConfig) useColor() bool {
+	switch c.colorMode {
+	case LogColorAlways:
+		return true
+	case LogColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := c.consoleWriter().(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeConsole 输出 "前缀 内容"，内容使用颜色。newline 为 true 时输出一行，text 结尾没有换行时会加上换行，
+// 为 false 时 text 原样输出，用于 OutputXxxF 这类由 format 决定是否换行的函数。extra 原样输出在后面
+func (c *loggerConfig) writeConsole(li *LogInfo, text, extra string, newline bool) {
+	prefix := c.prefix
+	if prefix == nil {
+		prefix = defaultLogPrefix
+	}
+	var builder strings.Builder
+	builder.WriteString(prefix(li))
+	end := ""
+	if newline {
+		text = strings.TrimSuffix(text, "\n")
+		end = "\n"
+	}
+	if c.colored {
+		code, ok := ansiColors[li.Color]
+		if !ok {
+			code = ansiColors[ColorGray]
+		}
+		builder.WriteString("\x1b[" + code + "m")
+		builder.WriteString(text)
+		builder.WriteString("\x1b[0m")
+	} else {
+		builder.WriteString(text)
+	}
+	builder.WriteString(end)
+	if extra != "" {
+		builder.WriteString(extra)
+		builder.WriteString("\n")
+	}
+	c.writeRaw([]byte(builder.String()))
+}
+
+// writeRaw 在锁中写入控制台输出，保证并发输出的行不会交错
+func (c *loggerConfig) writeRaw(p []byte) {
+	_logMutex.Lock()
+	defer _logMutex.Unlock()
+	_, _ = c.consoleWriter().Write(p)
+}
+
+// outputColor 是 OutputColor 类函数的实现，只输出到控制台，newline 和 writeConsole 的相同
+func outputColor(trace, color, text string, newline bool) {
+	li := &LogInfo{
+		Level:     colorLevel(color),
+		Color:     color,
+		Trace:     trace,
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05.000"),
+	}
+	std().config().writeConsole(li, text, "", newline)
+}
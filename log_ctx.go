@@ -0,0 +1,117 @@
+package ju
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// LogFieldRequestId 是 request id 在日志字段中的名称
+	LogFieldRequestId = "request_id"
+	// LogFieldTraceId 是 trace id 在日志字段中的名称
+	LogFieldTraceId = "trace_id"
+)
+
+type logCtxKey struct{}
+
+// ContextWithLogFields 返回附加了日志字段的 context，参数和 LogEntry.With 相同。
+// 使用这个 context 的 LogCtx 类函数会把这些字段记录到日志中，所有的日志存储都会保存它们，控制台也会输出它们。
+// context 中原有的字段不会被修改，同名的字段使用新的值。
+// noinspection GoUnusedExportedFunction
+func ContextWithLogFields(ctx context.Context, kv ...interface{}) context.Context {
+	old := LogFieldsFromContext(ctx)
+	fields := make(JsonObject, len(old)+len(kv)/2)
+	for k, v := range old {
+		fields[k] = v
+	}
+	setLogFields(fields, kv)
+	return context.WithValue(ctx, logCtxKey{}, fields)
+}
+
+// ContextWithRequestId 返回附加了 request id 的 context，它记录在日志字段 request_id 中
+// noinspection GoUnusedExportedFunction
+func ContextWithRequestId(ctx context.Context, id string) context.Context {
+	return ContextWithLogFields(ctx, LogFieldRequestId, id)
+}
+
+// ContextWithTraceId 返回附加了 trace id 的 context，它记录在日志字段 trace_id 中
+// noinspection GoUnusedExportedFunction
+func ContextWithTraceId(ctx context.Context, id string) context.Context {
+	return ContextWithLogFields(ctx, LogFieldTraceId, id)
+}
+
+// LogFieldsFromContext 返回 context 中的日志字段，没有时返回 nil，返回值不能修改
+func LogFieldsFromContext(ctx context.Context) JsonObject {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logCtxKey{}).(JsonObject)
+	return fields
+}
+
+// RequestIdFromContext 返回 context 中的 request id，没有时返回空串
+// noinspection GoUnusedExportedFunction
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := LogFieldsFromContext(ctx)[LogFieldRequestId].(string)
+	return id
+}
+
+// TraceIdFromContext 返回 context 中的 trace id，没有时返回空串
+// noinspection GoUnusedExportedFunction
+func TraceIdFromContext(ctx context.Context) string {
+	id, _ := LogFieldsFromContext(ctx)[LogFieldTraceId].(string)
+	return id
+}
+
+// NewRequestId 生成一个 16 位的随机 id，可以用作 request id 或者 trace id
+// noinspection GoUnusedExportedFunction
+func NewRequestId() string {
+	return Rand58String(16)
+}
+
+// LogRequestMiddleware 给每个请求的 context 附加 request id，这样处理请求时使用 LogCtx 类函数记录的日志都带有相同的 request_id。
+// request id 优先使用请求头 X-Request-Id，没有时生成一个新的，并且通过响应头 X-Request-Id 返回给客户端。
+// noinspection GoUnusedExportedFunction
+func LogRequestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > 128 {
+			id = NewRequestId()
+		}
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestId(r.Context(), id)))
+	})
+}
+
+// WithContext 添加 context 中的日志字段，LogEntry 中已有的同名字段会被覆盖
+func (e *LogEntry) WithContext(ctx context.Context) *LogEntry {
+	fields := LogFieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return e
+	}
+	return e.WithFields(fields)
+}
+
+// LogCtx 记录缺省日志，附带 ctx 中的日志字段，级别是 LevelInfo
+// noinspection GoUnusedExportedFunction
+func LogCtx(ctx context.Context, v ...interface{}) {
+	logFields(3, LevelInfo, LevelColor(LevelInfo), "", LogFieldsFromContext(ctx), v...)
+}
+
+// LogCtxTo 记录到 tag，附带 ctx 中的日志字段，级别是 LevelInfo
+// noinspection GoUnusedExportedFunction
+func LogCtxTo(ctx context.Context, tag string, v ...interface{}) {
+	logFields(3, LevelInfo, LevelColor(LevelInfo), tag, LogFieldsFromContext(ctx), v...)
+}
+
+// LogCtxColorTo 以指定颜色记录到 tag，附带 ctx 中的日志字段，级别由颜色决定，skip 的含义和 LogColor 相同
+// noinspection GoUnusedExportedFunction
+func LogCtxColorTo(ctx context.Context, skip int, color, tag string, v ...interface{}) {
+	logFields(3+skip, colorLevel(color), color, tag, LogFieldsFromContext(ctx), v...)
+}
+
+// LogCtxLevelTo 以指定级别记录到 tag，附带 ctx 中的日志字段，skip 的含义和 LogColor 相同
+// noinspection GoUnusedExportedFunction
+func LogCtxLevelTo(ctx context.Context, skip int, level LogLevel, tag string, v ...interface{}) {
+	logFields(3+skip, level, LevelColor(level), tag, LogFieldsFromContext(ctx), v...)
+}
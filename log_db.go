@@ -5,18 +5,69 @@ package ju
 import "fmt"
 
 type LogInfo struct {
-	Id        int    `json:"id"`
-	Color     string `json:"color"`
-	Log       string `json:"log"`
-	Trace     string `json:"trace"`
+	Id    int      `json:"id"`
+	Tag   string   `json:"tag"`
+	Level LogLevel `json:"level"`
+	Color string   `json:"color"`
+	Log   string   `json:"log"`
+	Trace string   `json:"trace"`
+	// Fields 是日志的结构化字段，没有字段时是 nil
+	Fields JsonObject `json:"fields,omitempty"`
+	// Stack 是完整的调用栈，开启 SetErrorStack 或者使用 WithStack 时才会记录，错误日志还包括被包装的错误链
+	Stack string `json:"stack,omitempty"`
+	// App, Host, Pid 是写入日志的进程，只有 SQL 存储（SqlLogDb）记录它们，其它情况是零值
+	App       string `json:"app,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Pid       int    `json:"pid,omitempty"`
 	CreatedAt string `json:"created_at"`
 }
 
 func (li *LogInfo) String() string {
-	return fmt.Sprintf("%s [%s %s] %s", li.CreatedAt, li.Color, li.Trace, li.Log)
+	str := fmt.Sprintf("%s [%s %s %s] %s", li.CreatedAt, li.Level, li.Color, li.Trace, li.Log)
+	if len(li.Fields) > 0 {
+		str += " " + li.Fields.logString()
+	}
+	if li.Stack != "" {
+		str += "\n" + li.Stack
+	}
+	return str
 }
 
+// LogDb 是日志的写入接口，SetLogParam 使用它保存日志。实现这个接口就可以把日志保存到自己的存储中。
 type LogDb interface {
-	//saveLog 保存日志，如果指定 tag 的日志达到设置上限，则替换掉最早的一条数据
-	saveLog(tag, color, trace, log string) bool
+	// SaveLog 保存日志，li.Tag 是日志的 tag，li.CreatedAt 已经设置好了，格式是 "2006-01-02 15:04:05.000"。
+	// 如果这个 tag 的日志超过设置上限，则删除最早的数据。成功返回 true
+	SaveLog(li *LogInfo) bool
 }
+
+// LogStore 是完整的日志存储接口，FileLogDb, SqliteLogDb, MysqlLogDb, PostgresLogDb 都实现了这个接口，
+// 管理工具可以使用它查询和维护日志，而不用关心具体的存储方式。
+type LogStore interface {
+	LogDb
+	// GetTags 返回所有存在日志的 tag，缺省日志的 tag 是空串
+	GetTags() []string
+	// GetLogs 获取 log，按时间从新到旧返回最多 count 条数据，page 是分页，从 0 开始，total 是对应 tag 的日志总数
+	GetLogs(tag string, page, count int) (logs []*LogInfo, total int64)
+	// QueryLogs 按条件查询日志，结果按 (created_at, id) 从新到旧排列，next 是下一页的 cursor，没有更多日志时是 nil
+	QueryLogs(q *LogQuery) (logs []*LogInfo, next *LogCursor)
+	// DeleteLog 删除指定 id 的日志，对于没有 id 的存储（比如文件）什么都不做
+	DeleteLog(tag string, id int64)
+	// DeleteTagLogs 删除特定 tag 中 created_at <= before 的日志，返回删除的条数
+	DeleteTagLogs(tag, before string) int64
+	// DeleteLogs 删除所有 tag 中 created_at <= before 的日志，返回删除的条数
+	DeleteLogs(before string) int64
+	// ClearTagLogs 清空指定 tag 的日志
+	ClearTagLogs(tag string) int64
+	// ClearLogs 清空全部日志
+	ClearLogs()
+	// Close 关闭存储
+	Close()
+}
+
+var (
+	_ LogStore = (*FileLogDb)(nil)
+	_ LogStore = (*SqliteLogDb)(nil)
+	_ LogStore = (*MysqlLogDb)(nil)
+	_ LogStore = (*PostgresLogDb)(nil)
+	_ LogStore = (*SqlLogDb)(nil)
+)
@@ -0,0 +1,174 @@
+package ju
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sqlExecutor 是 *sql.DB 和 *sql.Tx 共同的方法，保存日志的代码使用它，所以同一段代码可以在事务中执行
+type sqlExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// LogQueuePolicy 是异步日志队列满了以后的处理方式
+type LogQueuePolicy int
+
+const (
+	// LogQueueDrop 丢弃新的日志，不影响调用者，这是缺省值
+	LogQueueDrop LogQueuePolicy = iota
+	// LogQueueBlock 阻塞调用者，直到队列有空位
+	LogQueueBlock
+)
+
+// AsyncOption 是数据库日志异步模式的参数，所有的值都可以保持零值，表示使用缺省设置
+type AsyncOption struct {
+	// QueueSize 队列长度，缺省值是 4096
+	QueueSize int
+	// BatchSize 一个事务中最多写入的日志数量，缺省值是 200
+	BatchSize int
+	// FlushInterval 队列中的日志不足 BatchSize 时，最长等待多久写入数据库，缺省值是 1 秒
+	FlushInterval time.Duration
+	// Policy 队列满了以后的处理方式
+	Policy LogQueuePolicy
+}
+
+// asyncLogWriter 在后台协程中把日志成批写入数据库，save 负责在一个事务中写入一批日志
+type asyncLogWriter struct {
+	mu        sync.RWMutex
+	closed    bool
+	ch        chan *LogInfo
+	flushCh   chan chan struct{}
+	done      chan struct{}
+	exited    chan struct{}
+	batchSize int
+	interval  time.Duration
+	policy    LogQueuePolicy
+	dropped   atomic.Int64
+	save      func(logs []*LogInfo)
+}
+
+func newAsyncLogWriter(opt *AsyncOption, save func(logs []*LogInfo)) *asyncLogWriter {
+	if opt == nil {
+		opt = &AsyncOption{}
+	}
+	queueSize := opt.QueueSize
+	if queueSize <= 0 {
+		queueSize = 4096
+	}
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = 200
+	}
+	interval := opt.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	aw := &asyncLogWriter{
+		ch:        make(chan *LogInfo, queueSize),
+		flushCh:   make(chan chan struct{}),
+		done:      make(chan struct{}),
+		exited:    make(chan struct{}),
+		batchSize: batchSize,
+		interval:  interval,
+		policy:    opt.Policy,
+		save:      save,
+	}
+	go aw.run()
+	return aw
+}
+
+// push 把日志放入队列，队列满了时按 policy 处理，关闭以后返回 false
+func (aw *asyncLogWriter) push(li *LogInfo) bool {
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return false
+	}
+	if aw.policy == LogQueueBlock {
+		aw.ch <- li
+		return true
+	}
+	select {
+	case aw.ch <- li:
+		return true
+	default:
+		aw.dropped.Add(1)
+		return false
+	}
+}
+
+// flush 等待队列中已有的日志全部写入数据库
+func (aw *asyncLogWriter) flush() {
+	reply := make(chan struct{})
+	select {
+	case aw.flushCh <- reply:
+		<-reply
+	case <-aw.exited:
+	}
+}
+
+// close 停止接收日志，把队列中剩余的日志写入数据库，然后结束后台协程，可以多次调用
+func (aw *asyncLogWriter) close() {
+	aw.mu.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.done)
+	}
+	aw.mu.Unlock()
+	<-aw.exited
+}
+func (aw *asyncLogWriter) run() {
+	defer close(aw.exited)
+	ticker := time.NewTicker(aw.interval)
+	defer ticker.Stop()
+
+	var reported int64
+	batch := make([]*LogInfo, 0, aw.batchSize)
+	write := func() {
+		if len(batch) > 0 {
+			aw.save(batch)
+			batch = make([]*LogInfo, 0, aw.batchSize)
+		}
+		if dropped := aw.dropped.Load(); dropped != reported {
+			OutputColor(0, ColorYellow, fmt.Sprintf("日志队列已满，丢弃了 %d 条日志", dropped-reported))
+			reported = dropped
+		}
+	}
+	// drain 取出队列中当前所有的日志
+	drain := func() {
+		for {
+			select {
+			case li := <-aw.ch:
+				batch = append(batch, li)
+				if len(batch) >= aw.batchSize {
+					write()
+				}
+			default:
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case li := <-aw.ch:
+			batch = append(batch, li)
+			if len(batch) >= aw.batchSize {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		case reply := <-aw.flushCh:
+			drain()
+			write()
+			close(reply)
+		case <-aw.done:
+			drain()
+			write()
+			return
+		}
+	}
+}
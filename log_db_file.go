@@ -2,32 +2,51 @@ package ju
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type bufWriter struct {
 	mu     sync.Mutex
 	path   string
+	rotate *fileLogRotate
 	writer *bufio.Writer
 }
 
-func (bw *bufWriter) Write(p []byte) (n int, err error) {
+// write 把日志行写入缓冲区，缓冲区满了的时候才会写入文件
+func (bw *bufWriter) write(p []byte) error {
 	bw.mu.Lock()
 	defer bw.mu.Unlock()
+	_, err := bw.writer.Write(p)
+	return err
+}
+func (bw *bufWriter) flush() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.writer.Flush()
+}
+
+// Write 实现了 io.Writer 接口，只在缓冲区 Flush 时被 bufio.Writer 调用，此时已经持有 bw.mu
+func (bw *bufWriter) Write(p []byte) (n int, err error) {
+	if bw.rotate != nil {
+		p, n, err = bw.rotate.check(bw.path, p)
+		if err != nil || len(p) == 0 {
+			return n, err
+		}
+	}
 
 	// 关键：使用 O_APPEND 和 O_CREATE 模式打开文件。
 	// O_CREATE: 如果文件不存在，就自动创建它。这处理了文件被删除的情况。
 	// O_APPEND: 保证每次写入都在文件的当前末尾。这处理了文件被截断的情况。
 	file, err := os.OpenFile(bw.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
-		return 0, err
+		return n, err
 	}
 	defer func() {
 		err = file.Close() // 立即关闭文件句柄，释放文件锁
@@ -35,7 +54,8 @@ func (bw *bufWriter) Write(p []byte) (n int, err error) {
 	}()
 
 	// 执行写入操作
-	return file.Write(p)
+	wn, err := file.Write(p)
+	return n + wn, err
 }
 
 // fileLogWriter 是一个健壮的日志写入器。
@@ -47,14 +67,18 @@ type fileLogWriter struct {
 	name       string
 	folder     string
 	bufSize    int
+	format     atomic.Int32
+	rotate     *fileLogRotate
 	writerList map[string]*bufWriter
 }
 
 // newFileLogWriter 创建一个新的 fileLogWriter 实例。
-func newFileLogWriter(folder string, writeInterval time.Duration, bufSize int) *fileLogWriter {
+func newFileLogWriter(folder string, opt *FileLogOption) *fileLogWriter {
+	writeInterval := opt.WriteInterval
 	if writeInterval <= 0 {
 		writeInterval = 5 * time.Second
 	}
+	bufSize := opt.BufSize
 	if bufSize <= 0 {
 		bufSize = 4096 // 4KB 默认缓冲区大小
 	}
@@ -71,7 +95,9 @@ func newFileLogWriter(folder string, writeInterval time.Duration, bufSize int) *
 		folder:     folder,
 		name:       exeName,
 		bufSize:    bufSize,
+		rotate:     newFileLogRotate(opt),
 	}
+	flw.format.Store(int32(opt.Format))
 
 	// 启动后台的定时刷新任务
 	flw.start(writeInterval)
@@ -128,31 +154,27 @@ func GetServicePath(name string) string {
 	return str
 }
 
-// Write 实现了 io.Writer 接口。这是该写入器的核心逻辑，只在缓冲区 Flush 时被调用。
+// getWriter 返回 tag 文件对应的 bufWriter，如果还没有则创建一个
 func (w *fileLogWriter) getWriter(folder, tag string, bufSize int) *bufWriter {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	bw := w.writerList[tag]
 	if bw == nil {
 		bw = &bufWriter{
-			path: filepath.Join(folder, tag),
+			path:   filepath.Join(folder, tag),
+			rotate: w.rotate,
 		}
 		bw.writer = bufio.NewWriterSize(bw, bufSize)
 		w.writerList[tag] = bw
 	}
 	return bw
 }
-func (w *fileLogWriter) makeLine(color, trace, log string) []byte {
-	createdAt := time.Now().Format("2006-01-02 15:04:05.000")
-	line := fmt.Sprintf("%s\t%s\t%s\t%s\n", createdAt, color, trace, log)
-	return []byte(line)
-}
-func (w *fileLogWriter) saveLog(tag, color, trace, log string) bool {
-	tag = w.getTagName(tag)
-	data := w.makeLine(color, trace, log)
+func (w *fileLogWriter) saveLog(li *LogInfo) bool {
+	tag := w.getTagName(li.Tag)
+	data := EncodeLogLine(LogFormat(w.format.Load()), li)
 	wr := w.getWriter(w.folder, tag, w.bufSize)
-	_, err := wr.Write(data)
-	return OutputErrorTrace(err, 0)
+	err := wr.write(data)
+	return !OutputErrorTrace(err, 0)
 }
 func (w *fileLogWriter) getTagName(tag string) string {
 	if tag == "" {
@@ -164,12 +186,19 @@ func (w *fileLogWriter) getTagName(tag string) string {
 }
 func (w *fileLogWriter) clear(tag string) {
 	tag = w.getTagName(tag)
-	path := filepath.Join(w.folder, tag)
-	if !FileExist(path) {
+	wr := w.getWriter(w.folder, tag, w.bufSize)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	//缓冲区中还没有写入文件的日志也一起丢弃
+	wr.writer.Reset(wr)
+	if w.rotate != nil {
+		w.rotate.removeBackups(wr.path)
+	}
+	if !FileExist(wr.path) {
 		//如果文件不存在，不会创建它
 		return
 	}
-	file, err := os.Create(path)
+	file, err := os.Create(wr.path)
 	if OutputErrorTrace(err, 0) {
 		return
 	}
@@ -236,7 +265,7 @@ func (w *fileLogWriter) Flush() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	for _, wr := range w.writerList {
-		err := wr.writer.Flush()
+		err := wr.flush()
 		OutputErrorTrace(err, 1)
 	}
 }
@@ -250,6 +279,10 @@ func (w *fileLogWriter) Close() {
 		close(w.done)
 		// 执行最后一次刷新，确保所有剩余的日志都被写入磁盘
 		w.Flush()
+		if w.rotate != nil {
+			// 等待后台的压缩任务完成
+			w.rotate.wait()
+		}
 	})
 }
 
@@ -283,8 +316,17 @@ type FileLogDb struct {
 //
 // bufSize: 日志缓存缓存，默认值 4096 字节（传0），当缓存满了之后会执行一次写入文件操作。
 func CreateFileLogDb(folder string, writeInterval time.Duration, bufSize int) *FileLogDb {
+	return CreateFileLogDbWithOption(folder, &FileLogOption{WriteInterval: writeInterval, BufSize: bufSize})
+}
+
+// CreateFileLogDbWithOption 和 CreateFileLogDb 相同，但是使用 FileLogOption 设置参数，可以设置日志文件的切分和保留策略，
+// opt 传 nil 则全部使用缺省值。
+func CreateFileLogDbWithOption(folder string, opt *FileLogOption) *FileLogDb {
+	if opt == nil {
+		opt = &FileLogOption{}
+	}
 	ldb := &FileLogDb{
-		db: newFileLogWriter(folder, writeInterval, bufSize),
+		db: newFileLogWriter(folder, opt),
 	}
 	return ldb
 }
@@ -297,18 +339,30 @@ func CloseFileLogDb(db *FileLogDb) {
 	}
 }
 
-// DeleteLog 对于文件日志来说，这个函数什么都不做
+// DeleteLog 文件日志没有 id，这个函数什么都不做
 func (mdb *FileLogDb) DeleteLog(tag string, id int64) {
 }
 
-// DeleteTagLogs 对于文件日志来说，这个函数什么都不做
+// DeleteTagLogs 删除特定 tag before 日期之前的所有日志，和数据库日志一样，created_at 等于 before 的日志也会删除。
+// 文件会被重写，只保留 created_at 晚于 before 的日志行，切分文件如果全部是过期日志则直接删除。
+// before 的格式是 "2006-01-02 15:04:05.000"，可以省略毫秒部分。
 func (mdb *FileLogDb) DeleteTagLogs(tag, before string) int64 {
-	return 0
+	return mdb.db.deleteBefore(tag, before)
 }
 
-// DeleteLogs 对于文件日志来说，这个函数什么都不做
+// DeleteLogs 删除所有 tag before 日期之前的所有日志，参见 DeleteTagLogs
 func (mdb *FileLogDb) DeleteLogs(before string) int64 {
-	return 0
+	var count int64
+	for _, tag := range mdb.db.listTags() {
+		count += mdb.db.deleteBefore(tag, before)
+	}
+	return count
+}
+
+// SetFormat 设置日志文件的行格式，缺省是 LogFormatTab，修改格式后新的日志行使用新格式，已经写入的日志不会改变。
+// 读取日志时会自动识别每一行的格式，所以修改格式不影响读取已有的日志。
+func (mdb *FileLogDb) SetFormat(format LogFormat) {
+	mdb.db.format.Store(int32(format))
 }
 
 // GetLastLogs 获取最新的 log，bytes 是读取的字节数.
@@ -316,28 +370,62 @@ func (mdb *FileLogDb) DeleteLogs(before string) int64 {
 func (mdb *FileLogDb) GetLastLogs(tag string, bytes int) (logs []*LogInfo) {
 	lines := mdb.db.ReadLastLog(tag, int64(bytes))
 	for _, line := range lines {
-		params := strings.Split(line, "\t")
-		if len(params) < 4 {
-			//不合法的日志行
-			continue
+		li := ParseLogLine(line)
+		if li != nil {
+			li.Tag = tag
+			logs = append(logs, li)
 		}
-		li := LogInfo{
-			Id:        0,
-			CreatedAt: params[0],
-			Color:     params[1],
-			Trace:     params[2],
-			Log:       params[3],
-		}
-		logs = append(logs, &li)
 	}
 	return
 }
 
+// GetLogs 获取 log，返回最多 count 条数据，page 是分页，从 0 开始，日志按时间从新到旧排列，包括切分出的日志文件。
+// total 是对应 tag 的日志总数。文件日志没有 id，返回的日志 Id 都是 0，这个函数需要读取 tag 的全部日志文件。
+func (mdb *FileLogDb) GetLogs(tag string, page, count int) (logs []*LogInfo, total int64) {
+	return mdb.db.getLogs(tag, page, count)
+}
+
+// QueryLogs 按条件查询日志，结果按时间从新到旧排列，next 是下一页的 cursor，没有更多日志时是 nil。
+// 文件日志的查询需要扫描 tag 的全部日志文件，返回的日志 Id 是 created_at 相同的日志的序号，只用于 cursor。
+func (mdb *FileLogDb) QueryLogs(q *LogQuery) (logs []*LogInfo, next *LogCursor) {
+	if q == nil {
+		q = &LogQuery{}
+	}
+	return mdb.db.queryLogs(q)
+}
+
+// eachLog 按时间从旧到新逐条读取日志，ExportLogs 使用它一次读完所有文件，而不是分批调用 QueryLogs
+func (mdb *FileLogDb) eachLog(q *LogQuery, fn func(li *LogInfo) bool) {
+	mdb.db.eachLog(q, fn)
+}
+
+// GetTags 返回日志目录中当前应用的所有 tag，缺省日志的 tag 是空串
+func (mdb *FileLogDb) GetTags() []string {
+	return mdb.db.listTags()
+}
+
 // ClearTagLogs 清空指定 tag 的日志，默认日志对应的 tag 是空字符串
 func (mdb *FileLogDb) ClearTagLogs(tag string) int64 {
 	mdb.db.clear(tag)
 	return 0
 }
-func (mdb *FileLogDb) saveLog(tag, color, trace, log string) bool {
-	return mdb.db.saveLog(tag, color, trace, log)
+
+// ClearLogs 清空当前应用所有 tag 的日志
+func (mdb *FileLogDb) ClearLogs() {
+	for _, tag := range mdb.db.listTags() {
+		mdb.db.clear(tag)
+	}
+}
+
+// Flush 立即把缓冲区中的日志写入文件
+func (mdb *FileLogDb) Flush() {
+	mdb.db.Flush()
+}
+
+// Close 等同于 CloseFileLogDb
+func (mdb *FileLogDb) Close() {
+	CloseFileLogDb(mdb)
+}
+func (mdb *FileLogDb) SaveLog(li *LogInfo) bool {
+	return mdb.db.saveLog(li)
 }
@@ -0,0 +1,206 @@
+package ju
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// logBackupSuffix 匹配切分文件名中 .log 前面的日期和序号部分
+var logBackupSuffix = regexp.MustCompile(`\.\d{4}-\d{2}-\d{2}(\.\d+)?$`)
+
+// listTags 返回日志目录中当前应用的所有 tag，缺省日志的 tag 是空串
+func (w *fileLogWriter) listTags() []string {
+	//缓冲区中的日志可能还没有写入文件，对应的文件还不存在
+	w.Flush()
+	entries, err := os.ReadDir(w.folder)
+	if OutputErrorTrace(err, 0) {
+		return nil
+	}
+	var tags []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		name = strings.TrimSuffix(name, ".log")
+		if logBackupSuffix.MatchString(name) {
+			continue
+		}
+		if name == w.name {
+			tags = append(tags, "")
+		} else if strings.HasPrefix(name, w.name+"_") {
+			tags = append(tags, name[len(w.name)+1:])
+		}
+	}
+	return tags
+}
+
+// deleteBefore 删除 tag 中 created_at <= before 的日志，返回删除的日志条数。
+// 缓冲区中的日志先写入文件，然后在持有 bufWriter 锁的情况下重写文件，所以不会和日志写入冲突。
+// 切分文件如果全部是过期的日志则直接删除整个文件。
+func (w *fileLogWriter) deleteBefore(tag, before string) int64 {
+	wr := w.getWriter(w.folder, w.getTagName(tag), w.bufSize)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	err := wr.writer.Flush()
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	if w.rotate != nil {
+		//等待后台的压缩任务完成，避免处理正在压缩的文件
+		w.rotate.wait()
+	}
+
+	var count int64
+	for _, b := range listLogBackups(wr.path) {
+		if b.modTime.Format("2006-01-02 15:04:05.000") <= before {
+			//文件的修改时间不早于其中的最后一条日志，所以整个文件都是过期的
+			count += countLogLines(b.path)
+			err = os.Remove(b.path)
+			OutputErrorTrace(err, 0)
+			continue
+		}
+		count += filterLogFile(b.path, before)
+	}
+	if FileExist(wr.path) {
+		//当前文件也保持修改时间，按天切分根据它判断文件中日志的日期
+		count += filterLogFile(wr.path, before)
+	}
+	return count
+}
+
+// filterLogFile 重写日志文件，只保留 created_at > before 的日志行，.gz 文件会自动解压和压缩。
+// 不能解析的行（比如多行日志的后续行）跟随它前面的日志行。重写后的文件保持原来的修改时间
+func filterLogFile(path, before string) int64 {
+	src, err := os.Open(path)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	stat, err := src.Stat()
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	gz := strings.HasSuffix(path, ".gz")
+	var reader io.Reader = src
+	if gz {
+		zr, err := gzip.NewReader(src)
+		if OutputErrorTrace(err, 0) {
+			return 0
+		}
+		defer func() {
+			_ = zr.Close()
+		}()
+		reader = zr
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	var writer io.Writer = dst
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(dst)
+		writer = zw
+	}
+	bw := bufio.NewWriter(writer)
+
+	var deleted, kept int64
+	keep := true
+	br := bufio.NewReader(reader)
+	for {
+		line, rerr := br.ReadString('\n')
+		if line != "" {
+			if li := ParseLogLine(line); li != nil {
+				keep = li.CreatedAt > before
+				if keep {
+					kept++
+				} else {
+					deleted++
+				}
+			}
+			if keep {
+				_, err = bw.WriteString(line)
+				if err != nil {
+					break
+				}
+			}
+		}
+		if rerr != nil {
+			if rerr != io.EOF {
+				err = rerr
+			}
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	cerr := dst.Close()
+	if err == nil {
+		err = cerr
+	}
+	if OutputErrorTrace(err, 0) || deleted == 0 {
+		_ = os.Remove(tmp)
+		return 0
+	}
+	_ = src.Close()
+	if kept == 0 {
+		_ = os.Remove(tmp)
+		err = os.Remove(path)
+		OutputErrorTrace(err, 0)
+		return deleted
+	}
+	err = os.Rename(tmp, path)
+	if OutputErrorTrace(err, 0) {
+		_ = os.Remove(tmp)
+		return 0
+	}
+	_ = os.Chtimes(path, stat.ModTime(), stat.ModTime())
+	return deleted
+}
+
+// countLogLines 返回日志文件中能够解析的日志行数
+func countLogLines(path string) int64 {
+	file, err := os.Open(path)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if OutputErrorTrace(err, 0) {
+			return 0
+		}
+		defer func() {
+			_ = zr.Close()
+		}()
+		reader = zr
+	}
+	var count int64
+	br := bufio.NewReader(reader)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" && ParseLogLine(line) != nil {
+			count++
+		}
+		if err != nil {
+			return count
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package ju
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// followInterval 是 Follow 检查日志文件变化的间隔
+const followInterval = 500 * time.Millisecond
+
+// Follow 像 tail -F 一样跟踪 tag 的日志文件，返回接收新日志的通道和停止跟踪的函数，停止后通道会被关闭。
+// 跟踪从文件的当前末尾开始，文件被截断（ClearTagLogs）、删除或者切分后会从新文件的开头继续读取，
+// 文件被 DeleteLogs 重写后从上次读取的日志之后继续读取。
+// 日志先写入缓冲区，间隔写入文件，所以收到日志会有 writeInterval 的延迟，需要即时的日志时使用 SubscribeLogs。
+// 跟踪时不会一直打开日志文件，所以不影响其它程序操作日志文件。如果接收方处理不及时，Follow 会等待，不会丢弃日志。
+func (mdb *FileLogDb) Follow(tag string) (<-chan *LogInfo, func()) {
+	ch := make(chan *LogInfo, 256)
+	done := make(chan struct{})
+	path := mdb.db.getWriter(mdb.db.folder, mdb.db.getTagName(tag), mdb.db.bufSize).path
+	//在返回之前确定起点，缓冲区中的日志属于已有的日志，先写入文件，Follow 返回后保存的日志都会被收到
+	mdb.Flush()
+	ft := &fileTail{path: path}
+	ft.init()
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(followInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			for _, li := range ft.poll() {
+				li.Tag = tag
+				select {
+				case ch <- li:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// fileTail 记录跟踪文件的位置，每次 poll 读取上次之后新增的完整行
+type fileTail struct {
+	path   string
+	info   os.FileInfo
+	offset int64
+	rest   string
+	//since 是上次检查的时间，之后修改过的切分文件包含还没有读取的日志
+	since time.Time
+	//lastLine 是最后读取的完整行，lastTime 是最后读取的日志的时间，文件被重写时用来找到继续读取的位置
+	lastLine string
+	lastTime string
+}
+
+// init 从文件的当前末尾开始跟踪
+func (ft *fileTail) init() {
+	ft.since = time.Now()
+	info, err := os.Stat(ft.path)
+	if err == nil {
+		ft.info = info
+		ft.offset = info.Size()
+		ft.initLast()
+	}
+}
+
+// initLast 读取文件末尾的最后一行，作为 lastLine 和 lastTime
+func (ft *fileTail) initLast() {
+	file, err := os.Open(ft.path)
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	start := ft.offset - 64*1024
+	if start < 0 {
+		start = 0
+	}
+	data := make([]byte, ft.offset-start)
+	n, err := file.ReadAt(data, start)
+	if err != nil && err != io.EOF {
+		OutputErrorTrace(err, 0)
+		return
+	}
+	text := string(data[:n])
+	end := strings.LastIndexByte(text, '\n')
+	if end == -1 {
+		return
+	}
+	//不完整的最后一行从下一次读取开始
+	ft.offset = start + int64(end) + 1
+	lines := strings.Split(text[:end], "\n")
+	if start > 0 {
+		//第一行可能不完整
+		lines = lines[1:]
+	}
+	ft.setLast(lines)
+}
+
+// setLast 用读取的行更新 lastLine 和 lastTime
+func (ft *fileTail) setLast(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	ft.lastLine = lines[len(lines)-1]
+	for i := len(lines) - 1; i >= 0; i-- {
+		if li := ParseLogLine(lines[i]); li != nil {
+			ft.lastTime = li.CreatedAt
+			return
+		}
+	}
+}
+func (ft *fileTail) poll() []*LogInfo {
+	var logs []*LogInfo
+	now := time.Now()
+	info, err := os.Stat(ft.path)
+	if ft.info == nil || err != nil || !os.SameFile(ft.info, info) {
+		//文件被切分了，或者之前没有文件，新文件可能在两次检查之间就被切分了，先读取切分文件中还没有读取的日志
+		var rotated bool
+		logs, now, rotated = ft.drain(now)
+		if !rotated && ft.info != nil && err == nil {
+			//没有找到原来的文件，是文件被重写了（比如 DeleteLogs），不再读取已经读取过的日志
+			ft.resume(info)
+		} else {
+			ft.info = nil
+		}
+	}
+	ft.since = now
+	if err != nil {
+		//文件被删除或者切分后还没有新文件，等待新文件出现
+		ft.offset = 0
+		ft.rest = ""
+		return logs
+	}
+	if ft.info == nil || info.Size() < ft.offset {
+		//新文件或者文件被截断，从头开始读取
+		ft.offset = 0
+		ft.rest = ""
+	}
+	ft.info = info
+	return append(logs, ft.read(ft.path, info.Size())...)
+}
+
+// drain 从旧到新读取切分文件中还没有读取的日志：正在跟踪的文件从 ft.offset 开始读取，上次检查之后修改过的其它切分文件读取全部内容。
+// 返回的时间是 now 和读取过的切分文件的修改时间中最晚的一个，作为下一次的 since，这样同一个切分文件不会被读取两次。
+// 已经压缩的切分文件无法读取，设置了 Compress 时跟踪可能会漏掉压缩前没有读取的日志。rotated 表示找到了正在跟踪的文件
+func (ft *fileTail) drain(now time.Time) (logs []*LogInfo, last time.Time, rotated bool) {
+	backups := listLogBackups(ft.path)
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		if strings.HasSuffix(b.path, ".gz") {
+			continue
+		}
+		bi, err := os.Stat(b.path)
+		if err != nil {
+			continue
+		}
+		if ft.info != nil && os.SameFile(ft.info, bi) {
+			rotated = true
+		} else {
+			if !bi.ModTime().After(ft.since) {
+				continue
+			}
+			ft.offset = 0
+			ft.rest = ""
+		}
+		logs = append(logs, ft.read(b.path, bi.Size())...)
+		if bi.ModTime().After(now) {
+			now = bi.ModTime()
+		}
+	}
+	return logs, now, rotated
+}
+
+// resume 在重写后的文件中找到继续读取的位置：最后读取的一行之后，这一行被删除时从第一条晚于 lastTime 的日志开始
+func (ft *fileTail) resume(info os.FileInfo) {
+	ft.info = info
+	ft.offset = 0
+	ft.rest = ""
+	data, err := os.ReadFile(ft.path)
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	if int64(len(data)) > info.Size() {
+		data = data[:info.Size()]
+	}
+	text := string(data)
+	if ft.lastLine != "" {
+		if i := strings.LastIndex("\n"+text, "\n"+ft.lastLine+"\n"); i >= 0 {
+			ft.offset = int64(i + len(ft.lastLine) + 1)
+			return
+		}
+	}
+	pos := 0
+	for {
+		end := strings.IndexByte(text[pos:], '\n')
+		if end == -1 {
+			break
+		}
+		if li := ParseLogLine(text[pos : pos+end]); li != nil && li.CreatedAt > ft.lastTime {
+			break
+		}
+		pos += end + 1
+	}
+	ft.offset = int64(pos)
+}
+
+// read 读取 path 中 ft.offset 到 size 之间的完整行，不完整的最后一行保留到下一次读取
+func (ft *fileTail) read(path string, size int64) []*LogInfo {
+	if size <= ft.offset {
+		return nil
+	}
+	file, err := os.Open(path)
+	if OutputErrorTrace(err, 0) {
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	data := make([]byte, size-ft.offset)
+	n, err := file.ReadAt(data, ft.offset)
+	if err != nil && err != io.EOF {
+		OutputErrorTrace(err, 0)
+		return nil
+	}
+	ft.offset += int64(n)
+	text := ft.rest + string(data[:n])
+	end := strings.LastIndexByte(text, '\n')
+	if end == -1 {
+		ft.rest = text
+		return nil
+	}
+	ft.rest = text[end+1:]
+
+	lines := strings.Split(text[:end], "\n")
+	ft.setLast(lines)
+	var logs []*LogInfo
+	for _, line := range lines {
+		li := ParseLogLine(line)
+		if li != nil {
+			logs = append(logs, li)
+		} else if len(logs) > 0 {
+			//多行日志的后续行
+			last := logs[len(logs)-1]
+			last.Log += "\n" + strings.TrimRight(line, "\r")
+		}
+	}
+	return logs
+}
@@ -0,0 +1,261 @@
+package ju
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// readLogFile 按顺序读取日志文件中的日志，.gz 文件会自动解压，不能解析的行（多行日志的后续行）合并到前一条日志中。
+// fn 返回 false 时停止读取
+func readLogFile(path string, fn func(li *LogInfo) bool) {
+	r := openLogFile(path)
+	if r == nil {
+		return
+	}
+	defer r.close()
+	for li := r.next(); li != nil; li = r.next() {
+		if !fn(li) {
+			return
+		}
+	}
+}
+
+// logFileReader 逐条读取一个日志文件，规则和 readLogFile 相同
+type logFileReader struct {
+	file *os.File
+	zr   *gzip.Reader
+	br   *bufio.Reader
+	last *LogInfo
+	eof  bool
+}
+
+// openLogFile 打开日志文件，文件不存在或者出错时返回 nil
+func openLogFile(path string) *logFileReader {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if OutputErrorTrace(err, 0) {
+		return nil
+	}
+	r := &logFileReader{file: file}
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		r.zr, err = gzip.NewReader(file)
+		if OutputErrorTrace(err, 0) {
+			_ = file.Close()
+			return nil
+		}
+		reader = r.zr
+	}
+	r.br = bufio.NewReader(reader)
+	return r
+}
+
+// next 返回下一条日志，读完时返回 nil。一条日志在读到下一条日志的行时才返回，因为之后可能还有它的后续行
+func (r *logFileReader) next() *LogInfo {
+	for !r.eof {
+		line, err := r.br.ReadString('\n')
+		if err != nil {
+			r.eof = true
+		}
+		if line == "" {
+			continue
+		}
+		li := ParseLogLine(line)
+		if li == nil {
+			if r.last != nil {
+				r.last.Log += "\n" + strings.TrimRight(line, "\r\n")
+			}
+			continue
+		}
+		prev := r.last
+		r.last = li
+		if prev != nil {
+			return prev
+		}
+	}
+	li := r.last
+	r.last = nil
+	return li
+}
+func (r *logFileReader) close() {
+	if r.zr != nil {
+		_ = r.zr.Close()
+	}
+	_ = r.file.Close()
+}
+
+// tagLogReader 从最早的文件开始逐条读取 tag 的日志
+type tagLogReader struct {
+	tag string
+	// files 是还没有读取的文件，最早的文件在最后
+	files []string
+	cur   *logFileReader
+}
+
+// next 返回下一条满足 q 的日志，读完时返回 nil
+func (tr *tagLogReader) next(q *LogQuery) *LogInfo {
+	for {
+		if tr.cur != nil {
+			li := tr.cur.next()
+			if li == nil {
+				tr.cur.close()
+				tr.cur = nil
+				continue
+			}
+			if q.match(li) {
+				li.Tag = tr.tag
+				return li
+			}
+			continue
+		}
+		if len(tr.files) == 0 {
+			return nil
+		}
+		path := tr.files[len(tr.files)-1]
+		tr.files = tr.files[:len(tr.files)-1]
+		tr.cur = openLogFile(path)
+	}
+}
+func (tr *tagLogReader) close() {
+	if tr.cur != nil {
+		tr.cur.close()
+		tr.cur = nil
+	}
+}
+
+// tagFiles 返回 tag 的所有日志文件，当前文件在最前面，然后是按时间从新到旧的切分文件
+func (w *fileLogWriter) tagFiles(tag string) []string {
+	wr := w.getWriter(w.folder, w.getTagName(tag), w.bufSize)
+	files := []string{wr.path}
+	for _, b := range listLogBackups(wr.path) {
+		files = append(files, b.path)
+	}
+	return files
+}
+
+// getLogs 按时间从新到旧返回 tag 的第 page 页日志，缓冲区中的日志会先写入文件
+func (w *fileLogWriter) getLogs(tag string, page, count int) (logs []*LogInfo, total int64) {
+	wr := w.getWriter(w.folder, w.getTagName(tag), w.bufSize)
+	err := wr.flush()
+	OutputErrorTrace(err, 0)
+
+	start := int64(page * count)
+	end := start + int64(count)
+	logs = make([]*LogInfo, 0, count)
+	for _, path := range w.tagFiles(tag) {
+		var fileLogs []*LogInfo
+		readLogFile(path, func(li *LogInfo) bool {
+			fileLogs = append(fileLogs, li)
+			return true
+		})
+		for i := len(fileLogs) - 1; i >= 0; i-- {
+			if total >= start && total < end {
+				fileLogs[i].Tag = tag
+				logs = append(logs, fileLogs[i])
+			}
+			total++
+		}
+	}
+	return
+}
+
+// queryLogs 扫描 tag 的所有日志文件（包括切分文件）查询日志。
+// 文件日志没有 id，这里把 created_at 相同的日志按写入顺序编号为 1, 2, 3...，作为 cursor 中的 id
+func (w *fileLogWriter) queryLogs(q *LogQuery) ([]*LogInfo, *LogCursor) {
+	tags := w.queryTags(q)
+	var all []*LogInfo
+	for _, tag := range tags {
+		files := w.tagFiles(tag)
+		//从最早的文件开始读取，保证相同 created_at 的日志按写入顺序排列
+		for i := len(files) - 1; i >= 0; i-- {
+			readLogFile(files[i], func(li *LogInfo) bool {
+				if q.match(li) {
+					li.Tag = tag
+					all = append(all, li)
+				}
+				return true
+			})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].CreatedAt != all[j].CreatedAt {
+			return all[i].CreatedAt < all[j].CreatedAt
+		}
+		return all[i].Tag < all[j].Tag
+	})
+	for i, li := range all {
+		li.Id = 1
+		if i > 0 && all[i-1].CreatedAt == li.CreatedAt {
+			li.Id = all[i-1].Id + 1
+		}
+	}
+
+	limit := q.limit()
+	logs := make([]*LogInfo, 0, limit+1)
+	for i := len(all) - 1; i >= 0 && len(logs) <= limit; i-- {
+		if q.Cursor == nil || q.Cursor.before(all[i]) {
+			logs = append(logs, all[i])
+		}
+	}
+	return pageLogs(logs, limit)
+}
+
+// queryTags 返回查询的 tag，q.Tags 为空时是所有的 tag，这些 tag 缓冲区中的日志会先写入文件
+func (w *fileLogWriter) queryTags(q *LogQuery) []string {
+	if len(q.Tags) == 0 {
+		return w.listTags()
+	}
+	for _, tag := range q.Tags {
+		err := w.getWriter(w.folder, w.getTagName(tag), w.bufSize).flush()
+		OutputErrorTrace(err, 0)
+	}
+	return q.Tags
+}
+
+// eachLog 按时间从旧到新逐条读取满足 q 的日志，每个文件只读取一遍，不会把日志全部读入内存，fn 返回 false 时停止。
+// 忽略 q.Cursor 和 q.Limit。每个 tag 的日志按文件中的顺序读取，多个 tag 按 created_at 合并，Id 的规则和 queryLogs 相同
+func (w *fileLogWriter) eachLog(q *LogQuery, fn func(li *LogInfo) bool) {
+	tags := w.queryTags(q)
+	readers := make([]*tagLogReader, len(tags))
+	heads := make([]*LogInfo, len(tags))
+	for i, tag := range tags {
+		readers[i] = &tagLogReader{tag: tag, files: w.tagFiles(tag)}
+		heads[i] = readers[i].next(q)
+	}
+	defer func() {
+		for _, tr := range readers {
+			tr.close()
+		}
+	}()
+	var prev *LogInfo
+	for {
+		k := -1
+		for i, li := range heads {
+			if li == nil {
+				continue
+			}
+			if k == -1 || li.CreatedAt < heads[k].CreatedAt || (li.CreatedAt == heads[k].CreatedAt && li.Tag < heads[k].Tag) {
+				k = i
+			}
+		}
+		if k == -1 {
+			return
+		}
+		li := heads[k]
+		heads[k] = readers[k].next(q)
+		li.Id = 1
+		if prev != nil && prev.CreatedAt == li.CreatedAt {
+			li.Id = prev.Id + 1
+		}
+		prev = li
+		if !fn(li) {
+			return
+		}
+	}
+}
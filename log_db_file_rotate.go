@@ -0,0 +1,248 @@
+package ju
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileLogOption 是 CreateFileLogDbWithOption 的参数，所有的值都可以保持零值，表示使用缺省设置
+type FileLogOption struct {
+	// WriteInterval 日志保存到文件的间隔，缺省值是 5 秒
+	WriteInterval time.Duration
+	// BufSize 日志缓存大小，缺省值是 4096 字节，缓存满了之后会执行一次写入文件操作
+	BufSize int
+	// Format 日志文件的行格式，缺省是 LogFormatTab
+	Format LogFormat
+
+	// MaxSize 单个日志文件的最大字节数，超过后切分出一个新文件，<= 0 表示不按大小切分
+	MaxSize int64
+	// Daily 为 true 时按天切分，每天的第一条日志会把前一天的日志文件改名为 app_tag.2006-01-02.log
+	Daily bool
+	// MaxBackups 最多保留的切分文件数量，<= 0 表示不限制
+	MaxBackups int
+	// MaxAge 切分文件的最长保留时间，按文件的修改时间计算，<= 0 表示不限制
+	MaxAge time.Duration
+	// Compress 为 true 时切分出的文件使用 gzip 压缩，文件名是 app_tag.2006-01-02.log.gz
+	Compress bool
+}
+
+// fileLogRotate 实现日志文件的切分和保留策略。
+// 当前日志总是写入 app_tag.log，切分时把它改名为 app_tag.日期.log，同一天切分多次时是 app_tag.日期.序号.log
+type fileLogRotate struct {
+	maxSize    int64
+	daily      bool
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	wg         sync.WaitGroup
+	// bgMu 让后台的压缩和清理任务依次执行，避免清理时删除正在压缩的文件
+	bgMu sync.Mutex
+}
+
+// newFileLogRotate 如果 opt 没有设置切分，返回 nil
+func newFileLogRotate(opt *FileLogOption) *fileLogRotate {
+	if opt.MaxSize <= 0 && !opt.Daily {
+		return nil
+	}
+	return &fileLogRotate{
+		maxSize:    opt.MaxSize,
+		daily:      opt.Daily,
+		maxBackups: opt.MaxBackups,
+		maxAge:     opt.MaxAge,
+		compress:   opt.Compress,
+	}
+}
+
+// check 在写入 p 之前检查是否需要切分文件，如果需要则执行切分。
+// 缓冲区写入文件时不一定在行的边界，如果当前文件的最后一行不完整，p 中直到第一个换行符的部分仍然写入旧文件，
+// 返回值 rest 是剩下需要写入新文件的数据，n 是已经写入旧文件的字节数
+func (fr *fileLogRotate) check(path string, p []byte) (rest []byte, n int, err error) {
+	stat, err := os.Stat(path)
+	if err != nil || stat.Size() == 0 {
+		//文件不存在或者是空文件，不需要切分
+		return p, 0, nil
+	}
+	now := time.Now()
+	day := stat.ModTime().Format(time.DateOnly)
+	need := false
+	if fr.daily && day != now.Format(time.DateOnly) {
+		need = true
+	} else if fr.maxSize > 0 && stat.Size()+int64(len(p)) > fr.maxSize {
+		need = true
+		day = now.Format(time.DateOnly)
+	}
+	if !need {
+		return p, 0, nil
+	}
+
+	if !fileEndsWithNewline(path, stat.Size()) {
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			n, err = appendFile(path, p[:i+1])
+			if err != nil {
+				return nil, n, err
+			}
+			p = p[i+1:]
+		}
+	}
+	fr.rotate(path, day)
+	return p, n, nil
+}
+
+// rotate 把当前日志文件改名为切分文件，然后在后台执行压缩和清理
+func (fr *fileLogRotate) rotate(path, day string) {
+	base := strings.TrimSuffix(path, ".log")
+	target := base + "." + day + ".log"
+	for i := 1; FileExist(target) || FileExist(target+".gz"); i++ {
+		target = base + "." + day + "." + strconv.Itoa(i) + ".log"
+	}
+	err := os.Rename(path, target)
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	fr.wg.Add(1)
+	go func() {
+		defer fr.wg.Done()
+		fr.bgMu.Lock()
+		defer fr.bgMu.Unlock()
+		if fr.compress {
+			gzipLogFile(target)
+		}
+		fr.cleanup(path)
+	}()
+}
+
+// wait 等待后台的压缩和清理任务完成
+func (fr *fileLogRotate) wait() {
+	fr.wg.Wait()
+}
+
+// cleanup 按 MaxBackups 和 MaxAge 删除过期的切分文件
+func (fr *fileLogRotate) cleanup(path string) {
+	if fr.maxBackups <= 0 && fr.maxAge <= 0 {
+		return
+	}
+	backups := listLogBackups(path)
+	now := time.Now()
+	for i, b := range backups {
+		// backups 是按时间从新到旧排列的
+		if (fr.maxBackups > 0 && i >= fr.maxBackups) || (fr.maxAge > 0 && now.Sub(b.modTime) > fr.maxAge) {
+			err := os.Remove(b.path)
+			OutputErrorTrace(err, 0)
+		}
+	}
+}
+
+// removeBackups 删除 path 对应的所有切分文件
+func (fr *fileLogRotate) removeBackups(path string) {
+	fr.wg.Wait()
+	for _, b := range listLogBackups(path) {
+		err := os.Remove(b.path)
+		OutputErrorTrace(err, 0)
+	}
+}
+
+type logBackup struct {
+	path    string
+	modTime time.Time
+}
+
+// listLogBackups 返回 path 对应的切分文件，按修改时间从新到旧排列
+func listLogBackups(path string) []logBackup {
+	dir := filepath.Dir(path)
+	base := strings.TrimSuffix(filepath.Base(path), ".log")
+	reg := regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `\.\d{4}-\d{2}-\d{2}(\.\d+)?\.log(\.gz)?$`)
+	entries, err := os.ReadDir(dir)
+	if OutputErrorTrace(err, 0) {
+		return nil
+	}
+	var backups []logBackup
+	for _, entry := range entries {
+		if entry.IsDir() || !reg.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, logBackup{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].modTime.Equal(backups[j].modTime) {
+			return backups[i].path > backups[j].path
+		}
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups
+}
+
+// gzipLogFile 把文件压缩为 path.gz，成功后删除原文件，压缩文件保持原文件的修改时间
+func gzipLogFile(path string) {
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		//文件已经被清理掉了
+		return
+	}
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	stat, err := src.Stat()
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	cerr := dst.Close()
+	if err == nil {
+		err = cerr
+	}
+	if OutputErrorTrace(err, 0) {
+		_ = os.Remove(path + ".gz")
+		return
+	}
+	_ = os.Chtimes(path+".gz", stat.ModTime(), stat.ModTime())
+	_ = src.Close()
+	err = os.Remove(path)
+	OutputErrorTrace(err, 0)
+}
+
+func fileEndsWithNewline(path string, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	b := make([]byte, 1)
+	_, err = file.ReadAt(b, size-1)
+	return err != nil || b[0] == '\n'
+}
+func appendFile(path string, p []byte) (int, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return file.Write(p)
+}
@@ -0,0 +1,127 @@
+package ju
+
+import (
+	"fmt"
+)
+
+// LogSink 是 MultiLogDb 中的一个日志存储和它的过滤条件
+type LogSink struct {
+	Db LogDb
+	// MinLevel 这个存储接收的最低日志级别
+	MinLevel LogLevel
+	// Tags 只接收这些 tag 的日志，为空时接收全部 tag，缺省日志的 tag 是空串
+	Tags []string
+	// ExcludeTags 不接收这些 tag 的日志，它优先于 Tags
+	ExcludeTags []string
+}
+
+type multiLogSink struct {
+	db       LogDb
+	minLevel LogLevel
+	tags     map[string]bool
+	exclude  map[string]bool
+}
+
+func (ms *multiLogSink) accept(li *LogInfo) bool {
+	if li.Level < ms.minLevel || ms.exclude[li.Tag] {
+		return false
+	}
+	return ms.tags == nil || ms.tags[li.Tag]
+}
+
+// MultiLogDb 把日志同时保存到多个存储中，每个存储可以有自己的级别和 tag 过滤条件，比如错误日志保存到 Sqlite 供管理界面使用，
+// 全部日志保存到文件。它本身也是一个 LogDb，可以传给 SetLogParam。
+// 存储按顺序依次写入，一个存储写入失败（或者 panic）不会影响其它存储，慢速的存储应该使用异步模式，以免拖慢后面的存储。
+type MultiLogDb struct {
+	sinks []*multiLogSink
+}
+
+// CreateMultiLogDb 使用 sinks 创建 MultiLogDb，Db 为 nil 的 sink 会被忽略
+// noinspection GoUnusedExportedFunction
+func CreateMultiLogDb(sinks ...*LogSink) *MultiLogDb {
+	mdb := &MultiLogDb{}
+	for _, sink := range sinks {
+		if sink == nil || sink.Db == nil {
+			continue
+		}
+		ms := &multiLogSink{db: sink.Db, minLevel: sink.MinLevel}
+		if len(sink.Tags) > 0 {
+			ms.tags = make(map[string]bool, len(sink.Tags))
+			for _, tag := range sink.Tags {
+				ms.tags[tag] = true
+			}
+		}
+		if len(sink.ExcludeTags) > 0 {
+			ms.exclude = make(map[string]bool, len(sink.ExcludeTags))
+			for _, tag := range sink.ExcludeTags {
+				ms.exclude[tag] = true
+			}
+		}
+		mdb.sinks = append(mdb.sinks, ms)
+	}
+	return mdb
+}
+
+// SaveLog 把日志写入所有接收它的存储，只要有一个存储写入失败就返回 false
+func (mdb *MultiLogDb) SaveLog(li *LogInfo) bool {
+	ok := true
+	for _, sink := range mdb.sinks {
+		if sink.accept(li) && !sink.save(li, false) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// importLog 和 SaveLog 相同，但是实现了 logImporter 的存储导入时不执行保留策略
+func (mdb *MultiLogDb) importLog(li *LogInfo) bool {
+	ok := true
+	for _, sink := range mdb.sinks {
+		if sink.accept(li) && !sink.save(li, true) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// save 写入一个存储，importing 为 true 时优先使用 logImporter。
+// 存储的 panic 会被捕获并输出到控制台，这里不能使用 Log 类函数，否则可能循环调用
+func (ms *multiLogSink) save(li *LogInfo, importing bool) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			OutputColor(0, ColorRed, fmt.Sprintf("log sink %T panic: %v", ms.db, r))
+			ok = false
+		}
+	}()
+	if im, is := ms.db.(logImporter); is && importing {
+		return im.importLog(li)
+	}
+	return ms.db.SaveLog(li)
+}
+
+// Flush 调用所有实现了 Flush 方法的存储，让缓冲和队列中的日志写入存储
+func (mdb *MultiLogDb) Flush() {
+	for _, sink := range mdb.sinks {
+		if f, ok := sink.db.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+	}
+}
+
+// setLogCaps 把 Logger 的条数上限设置到所有使用条数上限的存储
+func (mdb *MultiLogDb) setLogCaps(maxLogCount, maxMainLogCount int64) {
+	for _, sink := range mdb.sinks {
+		if cs, ok := sink.db.(logCapsSetter); ok {
+			cs.setLogCaps(maxLogCount, maxMainLogCount)
+		}
+	}
+}
+
+// Close 关闭所有实现了 Close 方法的存储
+func (mdb *MultiLogDb) Close() {
+	for _, sink := range mdb.sinks {
+		if c, ok := sink.db.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
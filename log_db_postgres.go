@@ -0,0 +1,66 @@
+package ju
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// postgresLogDialect 是 PostgreSQL 的 SqlLogDialect
+var postgresLogDialect = &SqlLogDialect{
+	Name: "postgres",
+	Migrations: [][]string{{`CREATE TABLE IF NOT EXISTS {table} (
+    id BIGSERIAL PRIMARY KEY,
+    tag VARCHAR(255) NOT NULL DEFAULT '',
+    level SMALLINT NOT NULL DEFAULT 2,
+    log TEXT NOT NULL,
+    trace VARCHAR(255) NOT NULL,
+    color VARCHAR(16) NOT NULL DEFAULT '',
+    fields TEXT NOT NULL DEFAULT '',
+    stack TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3)
+);`,
+		// Postgres 的索引名在 schema 中是唯一的，{idx} 对于不是 log 的表包含表名
+		`CREATE INDEX IF NOT EXISTS {idx}_tag_created_at ON {table} (tag, created_at);`,
+	}, {`ALTER TABLE {table}
+    ADD COLUMN IF NOT EXISTS app VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS host VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS pid INTEGER NOT NULL DEFAULT 0`,
+	}},
+	// 转换为日志使用的 "2006-01-02 15:04:05.000" 格式，不依赖驱动对 TIMESTAMP 的处理
+	CreatedAt:  "to_char(created_at, 'YYYY-MM-DD HH24:MI:SS.MS')",
+	TrimOldest: "DELETE FROM {table} WHERE id IN (SELECT id FROM {table} WHERE tag=? ORDER BY created_at LIMIT ?)",
+	Truncate:   []string{"TRUNCATE {table} RESTART IDENTITY"},
+	Placeholder: func(n int) string {
+		return "$" + strconv.Itoa(n)
+	},
+	SavepointPerLog: true,
+}
+
+// PostgresLogDb 是使用 PostgreSQL 的 SqlLogDb
+type PostgresLogDb struct {
+	SqlLogDb
+}
+
+// CreatePostgresLogDb 返回一个 PostgreSQL 的 LogDb 对象，db 参数必须是一个有效的 PostgreSQL 数据库对象。
+// ju 不引入 PostgreSQL 的驱动，使用者需要自己导入，比如 github.com/lib/pq 或者 github.com/jackc/pgx/v5/stdlib
+// noinspection GoUnusedExportedFunction
+func CreatePostgresLogDb(db *sql.DB) *PostgresLogDb {
+	return CreatePostgresLogDbWithOption(db, nil)
+}
+
+// CreatePostgresLogDbWithOption 和 CreatePostgresLogDb 相同，但是可以设置表名和 app 等参数，opt 可以是 nil
+// noinspection GoUnusedExportedFunction
+func CreatePostgresLogDbWithOption(db *sql.DB, opt *SqlLogOption) *PostgresLogDb {
+	ldb := &PostgresLogDb{}
+	if !ldb.init(db, postgresLogDialect, opt) {
+		return nil
+	}
+	return ldb
+}
+
+// ClosePostgresLogDb 关闭日志对象和它使用的数据库对象，异步模式下会先把队列中的日志写入数据库
+func ClosePostgresLogDb(db *PostgresLogDb) {
+	if db != nil {
+		db.Close()
+	}
+}
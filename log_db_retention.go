@@ -0,0 +1,131 @@
+package ju
+
+import (
+	"sync"
+	"time"
+)
+
+// LogRetention 是数据库中一个 tag 的日志保留策略，两个条件可以同时使用
+type LogRetention struct {
+	// MaxCount 最多保留的日志条数，<= 0 表示不限制
+	MaxCount int64
+	// MaxAge 日志的最长保留时间，<= 0 表示不限制
+	MaxAge time.Duration
+}
+
+// logAgeCheckInterval 是按时间清理日志的检查间隔
+const logAgeCheckInterval = time.Minute
+
+// sqlLogRetention 缓存每个 tag 的日志条数，这样保存日志时不需要每次都查询 count(*)。
+// 日志条数超过上限一定数量（上限的 1/10，最少 10 条）以后才一次性删除多余的最早日志，所以实际条数会短暂的超过上限。
+// 同一时间每个 tag 只有一个保存日志的调用执行删除，删除完成并重新查询条数之前，其它调用不会再删除，否则并发保存时会删除过多的日志。
+// 按时间保留的 tag 每隔 logAgeCheckInterval 删除一次过期日志。
+type sqlLogRetention struct {
+	mu sync.Mutex
+	// caps 是 Logger.SetParam 设置的条数上限，nil 时使用缺省 Logger 的设置
+	caps     *[2]int64
+	counts   map[string]int64
+	trimming map[string]bool
+	tags     map[string]LogRetention
+	ageCheck map[string]time.Time
+}
+
+func newSqlLogRetention() *sqlLogRetention {
+	return &sqlLogRetention{
+		counts:   map[string]int64{},
+		trimming: map[string]bool{},
+		tags:     map[string]LogRetention{},
+		ageCheck: map[string]time.Time{},
+	}
+}
+
+// get 返回 tag 的保留策略，没有单独设置的 tag 使用 SetLogParam 设置的条数上限
+func (r *sqlLogRetention) get(tag string) LogRetention {
+	if lr, ok := r.tags[tag]; ok {
+		return lr
+	}
+	caps := r.caps
+	if caps == nil {
+		c := std().config()
+		caps = &[2]int64{c.maxLogCount, c.maxMainLogCount}
+	}
+	if tag == "" {
+		return LogRetention{MaxCount: caps[1]}
+	}
+	return LogRetention{MaxCount: caps[0]}
+}
+
+// setCaps 设置没有单独设置保留策略的 tag 使用的条数上限
+func (r *sqlLogRetention) setCaps(maxLogCount, maxMainLogCount int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caps = &[2]int64{maxLogCount, maxMainLogCount}
+}
+func (r *sqlLogRetention) set(tag string, lr LogRetention) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tags[tag] = lr
+	delete(r.ageCheck, tag)
+}
+
+// seed 设置 tag 的日志条数，用于初始化缓存和修正缓存
+func (r *sqlLogRetention) seed(tag string, count int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[tag] = count
+}
+
+// trimmed 在删除最早的日志之后设置 tag 的日志条数，之后可以再次删除
+func (r *sqlLogRetention) trimmed(tag string, count int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[tag] = count
+	delete(r.trimming, tag)
+}
+
+// reset 清空缓存的条数，tags 为空时清空所有的 tag
+func (r *sqlLogRetention) reset(tags ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(tags) == 0 {
+		r.counts = map[string]int64{}
+		return
+	}
+	for _, tag := range tags {
+		r.counts[tag] = 0
+	}
+}
+
+// imported 记录 tag 导入了一条日志，导入不执行保留策略
+func (r *sqlLogRetention) imported(tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[tag]++
+}
+
+// added 记录 tag 新增了一条日志，返回需要删除的最早日志条数，以及按时间删除的截止时间（空串表示不需要）。
+// trimCount > 0 时调用者必须在删除之后调用 trimmed
+func (r *sqlLogRetention) added(tag string) (trimCount int64, before string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[tag]++
+	lr := r.get(tag)
+	if lr.MaxCount > 0 {
+		slack := lr.MaxCount / 10
+		if slack < 10 {
+			slack = 10
+		}
+		if r.counts[tag] > lr.MaxCount+slack && !r.trimming[tag] {
+			trimCount = r.counts[tag] - lr.MaxCount
+			r.trimming[tag] = true
+		}
+	}
+	if lr.MaxAge > 0 {
+		now := time.Now()
+		if now.Sub(r.ageCheck[tag]) >= logAgeCheckInterval {
+			r.ageCheck[tag] = now
+			before = now.Add(-lr.MaxAge).Format("2006-01-02 15:04:05.000")
+		}
+	}
+	return
+}
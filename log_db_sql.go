@@ -0,0 +1,472 @@
+package ju
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SqlLogDialect 描述一种数据库和日志表相关的差异，SqlLogDb 使用它生成 sql，
+// 支持新的数据库只需要定义一个 SqlLogDialect，然后使用 CreateSqlLogDb 创建日志存储。
+// SqlLogDb 使用的 sql 都用 ? 作为参数占位符，由 Placeholder 转换为数据库使用的形式，
+// 日志表的名字写作 {table}，SQLite 和 PostgreSQL 这样索引名在整个数据库（schema）中唯一的，索引名的前缀写作 {idx}，
+// 缺省表 log 的 {idx} 是 idx，其它表是 idx_表名
+type SqlLogDialect struct {
+	// Name 是数据库的名称，只用于显示
+	Name string
+	// Migrations 是日志表的迁移，第 i 个（从 0 开始）把表从版本 i 升级到版本 i+1，见 SqlLogDb.SchemaVersion。
+	// 第一个迁移创建日志表和索引，第二个迁移添加 app, host, pid 列，迁移完成后的表
+	// 必须有 id, tag, level, log, trace, color, fields, stack, app, host, pid, created_at 列，id 是自增的。
+	// 已经发布的迁移不能修改，修改表结构时在后面添加新的迁移
+	Migrations [][]string
+	// LegacyColumns 是没有版本表的旧版本 ju 创建的表可能缺少的列，[0] 是列名，之后是添加这一列并且填充已有日志的语句，
+	// 执行第一个迁移时检查并按顺序执行，没有旧版本时为空
+	LegacyColumns [][]string
+	// ColumnsQuery 查询日志表所有列名的语句，LegacyColumns 为空时不需要
+	ColumnsQuery string
+	// CreatedAt 是查询时 created_at 列的表达式，结果必须是 "2006-01-02 15:04:05.000" 格式的字符串，为空时直接使用 created_at
+	CreatedAt string
+	// TrimOldest 删除 tag 最早的若干条日志，参数是 tag 和条数
+	TrimOldest string
+	// Truncate 是清空日志表并重置自增 id 的语句，在一个事务中按顺序执行，不能删除表，否则迁移添加的列会丢失
+	Truncate []string
+	// Placeholder 返回第 n 个参数（从 1 开始）的占位符，为 nil 时使用 ?
+	Placeholder func(n int) string
+	// SavepointPerLog 为 true 时，批量保存的事务中每条日志使用一个保存点。
+	// 有的数据库（比如 PostgreSQL）在事务中某条语句出错后整个事务都会失败，需要保存点才能让其它日志保存成功
+	SavepointPerLog bool
+	// MigrateLock 是迁移之前获取会话锁的查询，结果是 1 表示成功，MigrateUnlock 释放这个锁。
+	// DDL 会隐式提交事务的数据库（比如 MySQL）需要设置，否则多个进程可能同时执行同一个迁移，DDL 可以在事务中执行的数据库不需要
+	MigrateLock   string
+	MigrateUnlock string
+}
+
+// rebind 把 sql 中的 ? 替换为数据库的占位符，sql 中不能有其它用途的 ?
+func (d *SqlLogDialect) rebind(query string) string {
+	if d.Placeholder == nil || !strings.Contains(query, "?") {
+		return query
+	}
+	var builder strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			builder.WriteString(d.Placeholder(n))
+		} else {
+			builder.WriteRune(c)
+		}
+	}
+	return builder.String()
+}
+
+func (d *SqlLogDialect) createdAt() string {
+	if d.CreatedAt == "" {
+		return "created_at"
+	}
+	return d.CreatedAt
+}
+
+// SqlLogOption 是 SQL 日志存储的参数，所有的值都可以保持零值，表示使用缺省设置
+type SqlLogOption struct {
+	// Table 日志表的名字，缺省是 log，只能使用字母、数字和下划线。不能用 schema.table 的形式指定 schema，
+	// 需要时设置连接的缺省 schema，比如 PostgreSQL 的 search_path。
+	// 版本表的名字是它加上 _schema。多个服务共用一个数据库时，可以使用不同的表，也可以共用一个表，用 app 列区分
+	Table string
+	// App 写入 app 列的应用名，缺省是可执行文件的名字（不含扩展名）
+	App string
+	// Host 写入 host 列的主机名，缺省是 os.Hostname 的返回值
+	Host string
+}
+
+// SqlLogDb 是使用 database/sql 的日志存储，数据库的差异由 SqlLogDialect 决定，
+// SqliteLogDb, MysqlLogDb, PostgresLogDb 都是它加上对应的 SqlLogDialect。
+// 每条日志都会记录写入它的进程的 app, host 和 pid，多个进程共用一个表时可以用 LogQuery 的 App, Host, Pid 区分，
+// 但是条数上限和 GetTags, ClearTagLogs 等维护操作是针对整个表的
+type SqlLogDb struct {
+	db        *sql.DB
+	dialect   *SqlLogDialect
+	async     *asyncLogWriter
+	retention *sqlLogRetention
+	table     string
+	replacer  *strings.Replacer
+	app       string
+	host      string
+	pid       int
+}
+
+// CreateSqlLogDb 返回一个使用 dialect 的 SqlLogDb，db 参数必须是一个有效的数据库对象，opt 可以是 nil。
+// 表不存在时会创建，已经存在的表会执行没有执行过的迁移。db 或者 dialect 是 nil，或者表名不合法时返回 nil
+// noinspection GoUnusedExportedFunction
+func CreateSqlLogDb(db *sql.DB, dialect *SqlLogDialect, opt *SqlLogOption) *SqlLogDb {
+	ldb := &SqlLogDb{}
+	if !ldb.init(db, dialect, opt) {
+		return nil
+	}
+	return ldb
+}
+
+var sqlLogTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// init 初始化日志存储，创建日志表或者把它迁移到最新版本，db 或者 dialect 是 nil，或者表名不合法时返回 false
+func (sdb *SqlLogDb) init(db *sql.DB, dialect *SqlLogDialect, opt *SqlLogOption) bool {
+	if db == nil || dialect == nil {
+		OutputColor(2, "red", "传入的数据库对象和 dialect 不能是 nil")
+		return false
+	}
+	if opt == nil {
+		opt = &SqlLogOption{}
+	}
+	sdb.table = opt.Table
+	if sdb.table == "" {
+		sdb.table = "log"
+	}
+	if !sqlLogTableName.MatchString(sdb.table) {
+		OutputColor(2, "red", "日志表的名字不合法:", sdb.table)
+		return false
+	}
+	idx := "idx"
+	if sdb.table != "log" {
+		idx = "idx_" + sdb.table
+	}
+	sdb.replacer = strings.NewReplacer("{table}", sdb.table, "{idx}", idx)
+	sdb.app = opt.App
+	if sdb.app == "" {
+		sdb.app = strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	}
+	sdb.host = opt.Host
+	if sdb.host == "" {
+		sdb.host, _ = os.Hostname()
+	}
+	sdb.pid = os.Getpid()
+
+	sdb.db = db
+	sdb.dialect = dialect
+	sdb.retention = newSqlLogRetention()
+	if !sdb.migrate() {
+		return false
+	}
+	sdb.seedCounts()
+	return true
+}
+
+// Dialect 返回使用的 SqlLogDialect
+func (sdb *SqlLogDb) Dialect() *SqlLogDialect {
+	return sdb.dialect
+}
+
+// Table 返回日志表的名字
+func (sdb *SqlLogDb) Table() string {
+	return sdb.table
+}
+
+// sql 把 query 中的 {table}, {idx} 替换为实际的名字，把 ? 替换为数据库的占位符
+func (sdb *SqlLogDb) sql(query string) string {
+	return sdb.dialect.rebind(sdb.replacer.Replace(query))
+}
+func (sdb *SqlLogDb) exec(ex sqlExecutor, query string, args ...any) (sql.Result, error) {
+	return ex.Exec(sdb.sql(query), args...)
+}
+func (sdb *SqlLogDb) query(ex sqlExecutor, query string, args ...any) (*sql.Rows, error) {
+	return ex.Query(sdb.sql(query), args...)
+}
+
+// DeleteLog 删除指定 id 的日志
+func (sdb *SqlLogDb) DeleteLog(tag string, id int64) {
+	_, err := sdb.exec(sdb.db, "DELETE FROM {table} WHERE tag=? AND id=?", tag, id)
+	OutputErrorTrace(err, 0)
+	sdb.retention.seed(tag, sdb.getTotalCount(sdb.db, tag))
+}
+
+// DeleteTagLogs 删除特定 tag 中 created_at <= before 的日志，created_at 恰好等于 before 的日志也会删除
+func (sdb *SqlLogDb) DeleteTagLogs(tag, before string) int64 {
+	ret, err := sdb.exec(sdb.db, "DELETE FROM {table} WHERE tag=? AND created_at<=?", tag, before)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	sdb.retention.seed(tag, sdb.getTotalCount(sdb.db, tag))
+	count, err := ret.RowsAffected()
+	OutputErrorTrace(err, 0)
+	return count
+}
+
+// DeleteLogs 删除所有 tag 中 created_at <= before 的日志，created_at 恰好等于 before 的日志也会删除
+func (sdb *SqlLogDb) DeleteLogs(before string) int64 {
+	ret, err := sdb.exec(sdb.db, "DELETE FROM {table} WHERE created_at<=?", before)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	sdb.seedCounts()
+	count, err := ret.RowsAffected()
+	OutputErrorTrace(err, 0)
+	return count
+}
+
+// GetLogs 获取 log，返回最多 count 条数据，page 是分页，从 0 开始，顺序返回第 page*count+1 到 (page+1)*count+1 条日志.
+// 如果出现错误 logs 会是 nil
+// total 是对应 tag 的日志总数
+func (sdb *SqlLogDb) GetLogs(tag string, page, count int) (logs []*LogInfo, total int64) {
+	total = sdb.getTotalCount(sdb.db, tag)
+	sqlCase := "SELECT " + sqlLogColumns + sdb.dialect.createdAt() + " FROM {table} WHERE tag=? ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	start := count * page
+	rows, err := sdb.query(sdb.db, sqlCase, tag, count, start)
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	return scanSqlLogs(rows, count), total
+}
+
+// QueryLogs 按条件查询日志，结果按 (created_at, id) 从新到旧排列，next 是下一页的 cursor，没有更多日志时是 nil
+func (sdb *SqlLogDb) QueryLogs(q *LogQuery) (logs []*LogInfo, next *LogCursor) {
+	if q == nil {
+		q = &LogQuery{}
+	}
+	where, args := q.sqlWhere()
+	limit := q.limit()
+	sqlCase := "SELECT " + sqlLogColumns + sdb.dialect.createdAt() + " FROM {table}" + where + " ORDER BY created_at DESC, id DESC LIMIT ?"
+	rows, err := sdb.query(sdb.db, sqlCase, append(args, limit+1)...)
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	return pageLogs(scanSqlLogs(rows, limit+1), limit)
+}
+
+// sqlLogColumns 是查询日志时 created_at 之前的列
+const sqlLogColumns = "id,tag,level,log,trace,color,fields,stack,app,host,pid,"
+
+// scanSqlLogs 读取 sqlLogColumns 加上 created_at 的查询结果并关闭 rows，
+// 可以为 NULL 的列（旧版本 MySQL 的表）读取为空串
+func scanSqlLogs(rows *sql.Rows, capacity int) []*LogInfo {
+	defer func() {
+		_ = rows.Close()
+	}()
+	logs := make([]*LogInfo, 0, capacity)
+	for rows.Next() {
+		var li LogInfo
+		var color, fields, stack sql.NullString
+		err := rows.Scan(&li.Id, &li.Tag, &li.Level, &li.Log, &li.Trace, &color, &fields, &stack, &li.App, &li.Host, &li.Pid, &li.CreatedAt)
+		if !OutputErrorTrace(err, 0) {
+			li.Color = color.String
+			li.Fields = decodeLogFields(fields.String)
+			li.Stack = stack.String
+			logs = append(logs, &li)
+		}
+	}
+	return logs
+}
+
+// GetTags 返回所有存在日志的 tag，缺省日志的 tag 是空串
+func (sdb *SqlLogDb) GetTags() []string {
+	rows, err := sdb.query(sdb.db, "SELECT DISTINCT tag FROM {table} ORDER BY tag")
+	if OutputErrorTrace(err, 0) {
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var tags []string
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if !OutputErrorTrace(err, 0) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Close 关闭日志对象和它使用的数据库对象，异步模式下会先把队列中的日志写入数据库
+func (sdb *SqlLogDb) Close() {
+	if sdb.async != nil {
+		sdb.async.close()
+	}
+	if sdb.db != nil {
+		err := sdb.db.Close()
+		OutputErrorTrace(err, 1)
+	}
+}
+func (sdb *SqlLogDb) getTotalCount(ex sqlExecutor, tag string) int64 {
+	rows, err := sdb.query(ex, "SELECT count(*) FROM {table} WHERE tag=?", tag)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var total int64
+	if rows.Next() {
+		err = rows.Scan(&total)
+		if OutputErrorTrace(err, 0) {
+			return 0
+		}
+	}
+	return total
+}
+
+// ClearTagLogs 清空指定 tag 的日志，默认日志的 tag 是空串
+func (sdb *SqlLogDb) ClearTagLogs(tag string) int64 {
+	rst, err := sdb.exec(sdb.db, "DELETE FROM {table} WHERE tag=?", tag)
+	if OutputErrorTrace(err, 0) {
+		return 0
+	}
+	sdb.retention.reset(tag)
+	count, _ := rst.RowsAffected()
+	return count
+}
+
+// ClearLogs 清空全部日志，重置表的自增 id，注意这会清空所有 tag 的日志。
+func (sdb *SqlLogDb) ClearLogs() {
+	tx, err := sdb.db.Begin()
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, query := range sdb.dialect.Truncate {
+		_, err = sdb.exec(tx, query)
+		if OutputErrorTrace(err, 0) {
+			return
+		}
+	}
+	err = tx.Commit()
+	if !OutputErrorTrace(err, 0) {
+		sdb.retention.reset()
+	}
+}
+
+// EnableAsync 开启异步模式，SaveLog 只把日志放入队列，由后台协程成批的在一个事务中写入数据库。
+// 这个函数应该在开始记录日志之前调用，并且只调用一次，开启后需要调用 Close 或者 Flush 保证队列中的日志写入数据库。
+func (sdb *SqlLogDb) EnableAsync(opt *AsyncOption) {
+	if sdb.async == nil {
+		sdb.async = newAsyncLogWriter(opt, sdb.saveLogs)
+	}
+}
+
+// Flush 在异步模式下等待队列中的日志全部写入数据库，同步模式下什么都不做
+func (sdb *SqlLogDb) Flush() {
+	if sdb.async != nil {
+		sdb.async.flush()
+	}
+}
+
+// SaveLog 保存日志，异步模式下只是把日志放入队列，队列满了且设置为丢弃时返回 false
+func (sdb *SqlLogDb) SaveLog(li *LogInfo) bool {
+	if sdb.async != nil {
+		return sdb.async.push(li)
+	}
+	return sdb.saveLog(sdb.db, li)
+}
+
+// saveLogs 在一个事务中保存多条日志，某条日志保存失败不影响其它日志
+func (sdb *SqlLogDb) saveLogs(logs []*LogInfo) {
+	tx, err := sdb.db.Begin()
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, li := range logs {
+		if !sdb.dialect.SavepointPerLog {
+			sdb.saveLog(tx, li)
+			continue
+		}
+		_, err = tx.Exec("SAVEPOINT ju_log")
+		if OutputErrorTrace(err, 0) {
+			return
+		}
+		if sdb.saveLog(tx, li) {
+			_, err = tx.Exec("RELEASE SAVEPOINT ju_log")
+		} else {
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT ju_log")
+		}
+		if OutputErrorTrace(err, 0) {
+			return
+		}
+	}
+	err = tx.Commit()
+	OutputErrorTrace(err, 0)
+}
+func (sdb *SqlLogDb) saveLog(ex sqlExecutor, li *LogInfo) bool {
+	if !sdb.insertLog(ex, li) {
+		return false
+	}
+	trimCount, before := sdb.retention.added(li.Tag)
+	if trimCount > 0 || before != "" {
+		sdb.trim(ex, li.Tag, trimCount, before)
+	}
+	return true
+}
+
+// importLog 保存 ImportLogs 导入的日志，不执行保留策略，否则条数上限以外的日志会在导入时被删除
+func (sdb *SqlLogDb) importLog(li *LogInfo) bool {
+	if !sdb.insertLog(sdb.db, li) {
+		return false
+	}
+	sdb.retention.imported(li.Tag)
+	return true
+}
+
+// insertLog 插入一条日志
+func (sdb *SqlLogDb) insertLog(ex sqlExecutor, li *LogInfo) bool {
+	sqlCase := "INSERT INTO {table} (level,color,trace,log,fields,stack,app,host,pid,created_at,tag) VALUES (?,?,?,?,?,?,?,?,?,?,?)"
+	//导入的日志（见 ImportLogs）保留原来的进程信息
+	app, host, pid := li.App, li.Host, li.Pid
+	if app == "" && host == "" && pid == 0 {
+		app, host, pid = sdb.app, sdb.host, sdb.pid
+	}
+	_, err := sdb.exec(ex, sqlCase, li.Level, li.Color, li.Trace, li.Log, encodeLogFields(li.Fields), li.Stack, app, host, pid, li.CreatedAt, li.Tag)
+	return !OutputErrorTrace(err, 0)
+}
+
+// trim 删除 tag 最早的 count 条日志和 created_at 早于 before 的日志，然后修正缓存的条数
+func (sdb *SqlLogDb) trim(ex sqlExecutor, tag string, count int64, before string) {
+	if count > 0 {
+		_, err := sdb.exec(ex, sdb.dialect.TrimOldest, tag, count)
+		OutputErrorTrace(err, 0)
+	}
+	if before != "" {
+		_, err := sdb.exec(ex, "DELETE FROM {table} WHERE tag=? AND created_at<?", tag, before)
+		OutputErrorTrace(err, 0)
+	}
+	//重新查询条数，其它进程也可能写入同一个表，这样缓存的误差不会累积
+	total := sdb.getTotalCount(ex, tag)
+	if count > 0 {
+		sdb.retention.trimmed(tag, total)
+	} else {
+		sdb.retention.seed(tag, total)
+	}
+}
+
+// seedCounts 查询每个 tag 的日志条数，初始化缓存
+func (sdb *SqlLogDb) seedCounts() {
+	rows, err := sdb.query(sdb.db, "SELECT tag, count(*) FROM {table} GROUP BY tag")
+	if OutputErrorTrace(err, 0) {
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	sdb.retention.reset()
+	for rows.Next() {
+		var tag string
+		var count int64
+		err = rows.Scan(&tag, &count)
+		if !OutputErrorTrace(err, 0) {
+			sdb.retention.seed(tag, count)
+		}
+	}
+}
+
+// SetTagRetention 单独设置 tag 的保留策略，没有设置的 tag 使用 SetLogParam 中的条数上限。
+// 日志条数超过上限一定数量（上限的 1/10，最少 10 条）后才会一次性删除多余的最早日志，
+// 按时间保留时每分钟最多检查一次，所以实际的日志会短暂的超过设置的上限。
+func (sdb *SqlLogDb) SetTagRetention(tag string, lr LogRetention) {
+	sdb.retention.set(tag, lr)
+}
+
+func (sdb *SqlLogDb) setLogCaps(maxLogCount, maxMainLogCount int64) {
+	sdb.retention.setCaps(maxLogCount, maxMainLogCount)
+}
@@ -0,0 +1,198 @@
+package ju
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// createLogSchemaTab 是记录日志表版本的表，表名是日志表的名字加上 _schema，只有 id=1 的一行，version 是已经执行的迁移个数，所有数据库都可以使用这个语句
+const createLogSchemaTab = `CREATE TABLE IF NOT EXISTS {table}_schema (id INTEGER PRIMARY KEY, version INTEGER NOT NULL)`
+
+// 旧版本的表没有 level 列，添加之后按颜色填充级别，和 tab 格式解析旧日志行时的 colorLevel 一致
+const (
+	legacyLevelError = "UPDATE {table} SET level=4 WHERE color='red'"
+	legacyLevelWarn  = "UPDATE {table} SET level=3 WHERE color='yellow'"
+)
+
+// SchemaVersion 返回日志表的版本，也就是已经执行的迁移个数，出错时返回 -1。
+// 如果数据库被更新版本的 ju 迁移过，它会大于 len(Dialect().Migrations)
+func (sdb *SqlLogDb) SchemaVersion() int {
+	version, ok := sdb.schemaVersion(sdb.db)
+	if !ok {
+		return -1
+	}
+	return version
+}
+
+// schemaVersion 查询日志表的版本，还没有版本记录时返回 -1
+func (sdb *SqlLogDb) schemaVersion(ex sqlExecutor) (int, bool) {
+	rows, err := sdb.query(ex, "SELECT version FROM {table}_schema WHERE id=1")
+	if OutputErrorTrace(err, 0) {
+		return 0, false
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	version := -1
+	if rows.Next() {
+		err = rows.Scan(&version)
+	} else {
+		err = rows.Err()
+	}
+	if OutputErrorTrace(err, 0) {
+		return 0, false
+	}
+	return version, true
+}
+
+// migrate 执行没有执行过的迁移，把日志表升级到最新版本。多个进程同时启动时，迁移是依次执行的，只有一个进程会执行某个迁移。
+// 版本在迁移的语句成功之后才更新，但是 MySQL 的 DDL 语句不能回滚，迁移中途出错时需要手动修复表结构
+func (sdb *SqlLogDb) migrate() bool {
+	_, err := sdb.exec(sdb.db, createLogSchemaTab)
+	if OutputErrorTrace(err, 0) {
+		return false
+	}
+	version, ok := sdb.schemaVersion(sdb.db)
+	if !ok {
+		return false
+	}
+	if version < 0 {
+		_, err = sdb.exec(sdb.db, "INSERT INTO {table}_schema (id, version) VALUES (1, 0)")
+		if err != nil {
+			//其它进程可能同时插入了版本记录，这时插入失败是正常的
+			version, ok = sdb.schemaVersion(sdb.db)
+			if !ok || version < 0 {
+				OutputErrorTrace(err, 0)
+				return false
+			}
+		} else {
+			version = 0
+		}
+	}
+	if version >= len(sdb.dialect.Migrations) {
+		return true
+	}
+
+	//会话锁和事务都需要在同一个连接上执行
+	ctx := context.Background()
+	conn, err := sdb.db.Conn(ctx)
+	if OutputErrorTrace(err, 0) {
+		return false
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if sdb.dialect.MigrateLock != "" {
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, sdb.sql(sdb.dialect.MigrateLock)).Scan(&locked)
+		if OutputErrorTrace(err, 0) {
+			return false
+		}
+		if locked.Int64 != 1 {
+			OutputErrorTrace(errors.New("获取日志表的迁移锁失败"), 0)
+			return false
+		}
+		defer func() {
+			_, err := conn.ExecContext(ctx, sdb.sql(sdb.dialect.MigrateUnlock))
+			OutputErrorTrace(err, 0)
+		}()
+	}
+	for version < len(sdb.dialect.Migrations) {
+		version, ok = sdb.runMigration(ctx, conn)
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// runMigration 在一个事务中执行下一个迁移，返回迁移后的版本。
+// 事务先锁住版本记录再读取版本，其它进程已经执行了这个迁移时不再执行，直接返回数据库中的版本
+func (sdb *SqlLogDb) runMigration(ctx context.Context, conn *sql.Conn) (int, bool) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if OutputErrorTrace(err, 0) {
+		return 0, false
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	//不改变版本的更新也会锁住版本记录（SQLite 是锁住整个数据库），同时迁移的其它进程会等待这个事务结束。
+	//MySQL 的 DDL 会隐式提交事务，释放这个锁，所以 MySQL 使用 MigrateLock
+	_, err = sdb.exec(tx, "UPDATE {table}_schema SET version=version WHERE id=1")
+	if OutputErrorTrace(err, 0) {
+		return 0, false
+	}
+	version, ok := sdb.schemaVersion(tx)
+	if !ok {
+		return 0, false
+	}
+	if version < 0 {
+		OutputErrorTrace(errors.New("日志表的版本记录不存在"), 0)
+		return 0, false
+	}
+	if version >= len(sdb.dialect.Migrations) {
+		return version, true
+	}
+	for _, query := range sdb.dialect.Migrations[version] {
+		_, err = sdb.exec(tx, query)
+		if OutputErrorTrace(err, 0) {
+			return version, false
+		}
+	}
+	if version == 0 && !sdb.addLegacyColumns(tx) {
+		return version, false
+	}
+	_, err = sdb.exec(tx, "UPDATE {table}_schema SET version=? WHERE id=1 AND version=?", version+1, version)
+	if OutputErrorTrace(err, 0) {
+		return version, false
+	}
+	err = tx.Commit()
+	if OutputErrorTrace(err, 0) {
+		return version, false
+	}
+	return version + 1, true
+}
+
+// addLegacyColumns 给没有版本表的旧版本 ju 创建的表添加缺少的列，CREATE TABLE IF NOT EXISTS 不会修改已经存在的表
+func (sdb *SqlLogDb) addLegacyColumns(ex sqlExecutor) bool {
+	if len(sdb.dialect.LegacyColumns) == 0 {
+		return true
+	}
+	existing := sdb.columns(ex)
+	if existing == nil {
+		return false
+	}
+	for _, col := range sdb.dialect.LegacyColumns {
+		if existing[col[0]] {
+			continue
+		}
+		for _, query := range col[1:] {
+			_, err := sdb.exec(ex, query)
+			if OutputErrorTrace(err, 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// columns 返回日志表已有的列，出错时返回 nil
+func (sdb *SqlLogDb) columns(ex sqlExecutor) map[string]bool {
+	rows, err := sdb.query(ex, sdb.dialect.ColumnsQuery)
+	if OutputErrorTrace(err, 0) {
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	cols := map[string]bool{}
+	for rows.Next() {
+		var col string
+		err = rows.Scan(&col)
+		if !OutputErrorTrace(err, 0) {
+			cols[col] = true
+		}
+	}
+	return cols
+}
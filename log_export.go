@@ -0,0 +1,350 @@
+package ju
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LogExportFormat 是 ExportLogs 的输出格式，ImportLogs 可以自动识别所有的格式
+type LogExportFormat int
+
+const (
+	// LogExportJson 每行一个 json 对象（JSON Lines），和 LogFormatJson 相同，包含全部信息
+	LogExportJson LogExportFormat = iota
+	// LogExportCsv 是带表头的 csv，列是 logCsvColumns，fields 是 json 字串
+	LogExportCsv
+	// LogExportTab 是 FileLogDb 的 tab 格式，它不包含 tag, app, host, pid，导入时 tag 使用 LogImportOption.Tag，
+	// 所以每个文件应该只导出一个 tag，这样导出的文件可以直接作为 FileLogDb 的日志文件
+	LogExportTab
+	// LogExportLogfmt 和 LogFormatLogfmt 相同
+	LogExportLogfmt
+)
+
+func (f LogExportFormat) String() string {
+	switch f {
+	case LogExportCsv:
+		return "csv"
+	case LogExportTab:
+		return "tab"
+	case LogExportLogfmt:
+		return "logfmt"
+	}
+	return "json"
+}
+
+// ParseLogExportFormat 解析格式名称："json"（或者 "jsonl"）, "csv", "tab", "logfmt"，不能识别的名称返回 LogExportJson 和 false
+func ParseLogExportFormat(s string) (LogExportFormat, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "json", "jsonl", "":
+		return LogExportJson, true
+	case "csv":
+		return LogExportCsv, true
+	case "tab":
+		return LogExportTab, true
+	case "logfmt":
+		return LogExportLogfmt, true
+	}
+	return LogExportJson, false
+}
+
+// logCsvColumns 是 csv 格式的表头，导入时按列名识别，所以列的顺序可以不同，缺少的列使用零值
+var logCsvColumns = []string{"created_at", "tag", "level", "color", "trace", "log", "fields", "stack", "app", "host", "pid"}
+
+// LogExportOption 是 ExportLogs 的参数，所有的值都可以保持零值
+type LogExportOption struct {
+	// Format 输出格式，缺省是 LogExportJson
+	Format LogExportFormat
+	// Tags 导出这些 tag 的日志，为空时导出所有 tag，缺省日志的 tag 是空串
+	Tags []string
+	// Since 只导出 created_at >= Since 的日志，格式是 "2006-01-02 15:04:05.000"，可以省略后面的部分
+	Since string
+	// Until 只导出 created_at <= Until 的日志
+	Until string
+	// BatchSize 每次从存储查询的条数，缺省值是 1000
+	BatchSize int
+}
+
+// logStreamer 是可以从旧到新逐条读取日志的存储实现的接口，ExportLogs 优先使用它
+type logStreamer interface {
+	eachLog(q *LogQuery, fn func(li *LogInfo) bool)
+}
+
+// ExportLogs 把 store 中的日志按时间从旧到新写入 w，返回写入的条数，出错时 ok 是 false，已经写入的日志不会撤销。
+// 日志是分批查询和写入的，不会一次读入内存。QueryLogs 是从新到旧查询的，为了按时间顺序输出，
+// 先查询一遍记录每一批的位置，再倒序读取每一批，所以每条日志会被查询两次，导出过程中新增的日志不会被导出。
+// FileLogDb 不使用 QueryLogs，而是从最早的文件开始把每个文件读取一遍，BatchSize 对它无效
+// noinspection GoUnusedExportedFunction
+func ExportLogs(w io.Writer, store LogStore, opt *LogExportOption) (count int64, ok bool) {
+	if opt == nil {
+		opt = &LogExportOption{}
+	}
+	if s, is := store.(logStreamer); is {
+		ew := newLogExportWriter(w, opt.Format)
+		var err error
+		s.eachLog(&LogQuery{Tags: opt.Tags, Since: opt.Since, Until: opt.Until}, func(li *LogInfo) bool {
+			err = ew.write(li)
+			if err != nil {
+				return false
+			}
+			count++
+			return true
+		})
+		if OutputErrorTrace(err, 0) {
+			return count, false
+		}
+		return count, !OutputErrorTrace(ew.flush(), 0)
+	}
+	batch := opt.BatchSize
+	if batch <= 0 {
+		batch = 1000
+	}
+	q := &LogQuery{Tags: opt.Tags, Since: opt.Since, Until: opt.Until, Limit: batch}
+
+	//cursors[i] 是第 i 批的起点，第 0 批从最新的日志开始，使用它的下一个位置，这样第二遍不会包含之后新增的日志
+	var cursors []*LogCursor
+	for {
+		logs, next := store.QueryLogs(q)
+		if len(logs) == 0 {
+			break
+		}
+		if len(cursors) == 0 {
+			cursors = append(cursors, &LogCursor{CreatedAt: logs[0].CreatedAt, Id: int64(logs[0].Id) + 1})
+		}
+		if next == nil {
+			break
+		}
+		cursors = append(cursors, next)
+		q.Cursor = next
+	}
+
+	ew := newLogExportWriter(w, opt.Format)
+	for i := len(cursors) - 1; i >= 0; i-- {
+		q.Cursor = cursors[i]
+		logs, _ := store.QueryLogs(q)
+		for j := len(logs) - 1; j >= 0; j-- {
+			if i+1 < len(cursors) && cursors[i+1].before(logs[j]) {
+				//第二遍查询时这一批的日志可能已经被删除，结果中会包含下一批（更早）的日志，它们已经在下一批中导出了
+				continue
+			}
+			if OutputErrorTrace(ew.write(logs[j]), 0) {
+				return count, false
+			}
+			count++
+		}
+	}
+	return count, !OutputErrorTrace(ew.flush(), 0)
+}
+
+// logExportWriter 按格式写入日志
+type logExportWriter struct {
+	w      io.Writer
+	format LogExportFormat
+	csv    *csv.Writer
+	header bool
+}
+
+func newLogExportWriter(w io.Writer, format LogExportFormat) *logExportWriter {
+	ew := &logExportWriter{w: w, format: format}
+	if format == LogExportCsv {
+		ew.csv = csv.NewWriter(w)
+	}
+	return ew
+}
+
+func (ew *logExportWriter) write(li *LogInfo) error {
+	switch ew.format {
+	case LogExportCsv:
+		if err := ew.csvHeader(); err != nil {
+			return err
+		}
+		pid := ""
+		if li.Pid != 0 {
+			pid = strconv.Itoa(li.Pid)
+		}
+		return ew.csv.Write([]string{li.CreatedAt, li.Tag, li.Level.String(), li.Color, li.Trace, li.Log,
+			encodeLogFields(li.Fields), li.Stack, li.App, li.Host, pid})
+	case LogExportTab:
+		_, err := ew.w.Write(EncodeLogLine(LogFormatTab, li))
+		return err
+	case LogExportLogfmt:
+		_, err := ew.w.Write(EncodeLogLine(LogFormatLogfmt, li))
+		return err
+	}
+	line := EncodeLogLine(LogFormatJson, li)
+	if line == nil {
+		return errors.New("encode log failed")
+	}
+	_, err := ew.w.Write(line)
+	return err
+}
+
+// csvHeader 在第一条日志之前写入表头
+func (ew *logExportWriter) csvHeader() error {
+	if ew.header {
+		return nil
+	}
+	ew.header = true
+	return ew.csv.Write(logCsvColumns)
+}
+
+// flush 写入缓存的数据，csv 格式没有日志时也写入表头
+func (ew *logExportWriter) flush() error {
+	if ew.csv == nil {
+		return nil
+	}
+	if err := ew.csvHeader(); err != nil {
+		return err
+	}
+	ew.csv.Flush()
+	return ew.csv.Error()
+}
+
+// LogImportOption 是 ImportLogs 的参数
+type LogImportOption struct {
+	// Tag 是不包含 tag 的格式（LogExportTab 格式和没有 tag 列的 csv）使用的 tag，缺省是空串，也就是缺省日志
+	Tag string
+}
+
+// logImporter 是导入日志时不执行保留策略的存储实现的接口，ImportLogs 优先使用它
+type logImporter interface {
+	importLog(li *LogInfo) bool
+}
+
+// ImportLogs 从 r 读取 ExportLogs 导出的日志，或者 FileLogDb 的日志文件，保存到 db 中，返回保存的条数。
+// 格式是自动识别的，created_at, trace, color 等都保持原来的值，SQL 存储会保留日志原来的 app, host, pid。
+// 不合法的行会被跳过，读取出错时 ok 是 false，已经保存的日志不会撤销。
+// SQL 存储（包括 MultiLogDb 中的）导入时不执行条数和时间的保留策略，所以导入的日志不会被删除，
+// 但是之后保存新日志时仍然会按保留策略删除最早的日志，需要长期保留时用 SetTagRetention 调整上限
+// noinspection GoUnusedExportedFunction
+func ImportLogs(r io.Reader, db LogDb, opt *LogImportOption) (count int64, ok bool) {
+	if opt == nil {
+		opt = &LogImportOption{}
+	}
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(logCsvColumns[0]) + 1)
+	var err error
+	var skipped int64
+	save := func(li *LogInfo, tagged bool) {
+		if li == nil {
+			skipped++
+			return
+		}
+		if !tagged {
+			li.Tag = opt.Tag
+		}
+		var saved bool
+		if im, is := db.(logImporter); is {
+			saved = im.importLog(li)
+		} else {
+			saved = db.SaveLog(li)
+		}
+		if saved {
+			count++
+		}
+	}
+	if string(head) == logCsvColumns[0]+"," {
+		err = readLogCsv(br, save)
+	} else {
+		err = readLogLines(br, save)
+	}
+	if f, ok := db.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+	if skipped > 0 {
+		OutputColor(0, ColorYellow, fmt.Sprintf("导入日志时跳过了 %d 行不合法的日志", skipped))
+	}
+	return count, !OutputErrorTrace(err, 0)
+}
+
+// readLogLines 读取 EncodeLogLine 编码的日志，每行一条，空行被忽略。
+// tab 格式的多行日志和 readLogFile 一样，不能解析的后续行（包括空行）合并到前一条日志中，所以一条日志在下一条开始时才保存
+func readLogLines(br *bufio.Reader, save func(li *LogInfo, tagged bool)) error {
+	var last *LogInfo
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			li := ParseLogLine(line)
+			if li == nil && last != nil {
+				last.Log += "\n" + strings.TrimRight(line, "\r\n")
+			} else if strings.TrimSpace(line) != "" {
+				if last != nil {
+					save(last, false)
+					last = nil
+				}
+				//json 和 logfmt 格式包含 tag，缺省日志的 tag 是省略的，tab 格式不包含 tag，只有 tab 格式的日志可能有后续行
+				if strings.HasPrefix(line, "{") || strings.HasPrefix(line, "created_at=") {
+					save(li, true)
+				} else if li != nil {
+					last = li
+				} else {
+					save(nil, false)
+				}
+			}
+		}
+		if err != nil {
+			if last != nil {
+				save(last, false)
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// readLogCsv 读取带表头的 csv，按表头的列名取值
+func readLogCsv(br *bufio.Reader, save func(li *LogInfo, tagged bool)) error {
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	_, tagged := columns["tag"]
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		li := &LogInfo{
+			CreatedAt: get("created_at"),
+			Tag:       get("tag"),
+			Color:     get("color"),
+			Trace:     get("trace"),
+			Log:       get("log"),
+			Fields:    decodeLogFields(get("fields")),
+			Stack:     get("stack"),
+			App:       get("app"),
+			Host:      get("host"),
+		}
+		li.Pid, _ = strconv.Atoi(get("pid"))
+		level, ok := ParseLogLevel(get("level"))
+		if !ok {
+			level = colorLevel(li.Color)
+		}
+		li.Level = level
+		if li.CreatedAt == "" {
+			li = nil
+		}
+		save(li, tagged)
+	}
+}
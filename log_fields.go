@@ -0,0 +1,171 @@
+package ju
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// LogEntry 是带有结构化字段的日志记录器，使用 Log 函数获取，比如：
+//
+//	ju.Log("user").With("uid", 42, "ip", ip).Info("login")
+//
+// LogEntry 是不可修改的，With 会返回一个新的对象，所以可以把公共字段保存下来重复使用。
+type LogEntry struct {
+	// logger 是记录日志的 Logger，nil 表示缺省 Logger
+	logger *Logger
+	tag    string
+	fields JsonObject
+	// stack 为 true 时记录完整的调用栈
+	stack bool
+}
+
+// Log 返回一个记录到 tag 的 LogEntry，缺省日志的 tag 是空串
+// noinspection GoUnusedExportedFunction
+func Log(tag string) *LogEntry {
+	return &LogEntry{tag: tag}
+}
+
+// With 添加字段，参数是 key, value 交替的列表，key 不是字符串时使用 fmt.Sprint 转换，
+// 如果参数个数是奇数，最后一个 key 的值是 nil，error 类型的值会保存为 err.Error()
+func (e *LogEntry) With(kv ...interface{}) *LogEntry {
+	ne := e.clone(len(kv) / 2)
+	setLogFields(ne.fields, kv)
+	return ne
+}
+func setLogFields(fields JsonObject, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var value interface{}
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		if err, ok := value.(error); ok {
+			//error 类型序列化为 json 时通常是 {}，这里保存它的文字描述
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+}
+
+// WithFields 添加 fields 中的全部字段
+func (e *LogEntry) WithFields(fields JsonObject) *LogEntry {
+	ne := e.clone(len(fields))
+	for k, v := range fields {
+		ne.fields[k] = v
+	}
+	return ne
+}
+func (e *LogEntry) clone(extra int) *LogEntry {
+	ne := &LogEntry{logger: e.logger, tag: e.tag, stack: e.stack, fields: make(JsonObject, len(e.fields)+extra)}
+	for k, v := range e.fields {
+		ne.fields[k] = v
+	}
+	return ne
+}
+
+func (e *LogEntry) getLogger() *Logger {
+	if e.logger == nil {
+		return std()
+	}
+	return e.logger
+}
+
+func (e *LogEntry) Trace(v ...interface{}) {
+	e.getLogger().logStack(3, e.stack, nil, LevelTrace, LevelColor(LevelTrace), e.tag, e.fields, v...)
+}
+func (e *LogEntry) Debug(v ...interface{}) {
+	e.getLogger().logStack(3, e.stack, nil, LevelDebug, LevelColor(LevelDebug), e.tag, e.fields, v...)
+}
+func (e *LogEntry) Info(v ...interface{}) {
+	e.getLogger().logStack(3, e.stack, nil, LevelInfo, LevelColor(LevelInfo), e.tag, e.fields, v...)
+}
+func (e *LogEntry) Warn(v ...interface{}) {
+	e.getLogger().logStack(3, e.stack, nil, LevelWarn, LevelColor(LevelWarn), e.tag, e.fields, v...)
+}
+func (e *LogEntry) Error(v ...interface{}) {
+	e.getLogger().logStack(3, e.stack, nil, LevelError, LevelColor(LevelError), e.tag, e.fields, v...)
+}
+func (e *LogEntry) Fatal(v ...interface{}) {
+	e.getLogger().logStack(3, e.stack, nil, LevelFatal, LevelColor(LevelFatal), e.tag, e.fields, v...)
+}
+
+// Color 以指定的级别和颜色记录日志，skip 的含义和 LogColor 相同
+func (e *LogEntry) Color(skip int, level LogLevel, color string, v ...interface{}) {
+	e.getLogger().logStack(3+skip, e.stack, nil, level, color, e.tag, e.fields, v...)
+}
+
+// logString 把字段格式化为 key=value 的形式，按 key 排序，用于控制台输出
+func (js JsonObject) logString() string {
+	keys := make([]string, 0, len(js))
+	for k := range js {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			builder.WriteString(" ")
+		}
+		builder.WriteString(k)
+		builder.WriteString("=")
+		builder.WriteString(logFieldValue(js[k]))
+	}
+	return builder.String()
+}
+func logFieldValue(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case error:
+		s = val.Error()
+	case fmt.Stringer:
+		s = val.String()
+	case nil:
+		return "null"
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(val)
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			s = fmt.Sprint(val)
+		} else {
+			s = string(data)
+		}
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// encodeLogFields 把字段编码为存储用的 json 字串，没有字段时返回空串
+func encodeLogFields(fields JsonObject) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(fields)
+	if OutputErrorTrace(err, 1) {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeLogFields 解析 encodeLogFields 生成的字串，空串或者不合法的数据返回 nil
+func decodeLogFields(s string) JsonObject {
+	if s == "" || s == "{}" {
+		return nil
+	}
+	var fields JsonObject
+	if json.Unmarshal([]byte(s), &fields) != nil {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,291 @@
+package ju
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// LogFormat 是日志行的编码格式，用于日志文件和控制台输出
+type LogFormat int
+
+const (
+	// LogFormatTab 是缺省格式。日志文件中是 created_at\tlevel\tcolor\ttrace\tfields\tstack\tlog，
+	// stack 是 json 字串，没有调用栈时是 ""，
+	// 控制台上是带颜色的 "时间 trace 日志 字段" 格式
+	LogFormatTab LogFormat = iota
+	// LogFormatJson 每行一个 json 对象（JSON Lines）
+	LogFormatJson
+	// LogFormatLogfmt 每行是 key=value 的列表，结构化字段直接作为 key 出现
+	LogFormatLogfmt
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	case LogFormatJson:
+		return "json"
+	case LogFormatLogfmt:
+		return "logfmt"
+	}
+	return "tab"
+}
+
+// ParseLogFormat 解析格式名称："tab", "json", "logfmt"，不能识别的名称返回 LogFormatTab 和 false
+func ParseLogFormat(s string) (LogFormat, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "tab", "":
+		return LogFormatTab, true
+	case "json", "jsonl":
+		return LogFormatJson, true
+	case "logfmt":
+		return LogFormatLogfmt, true
+	}
+	return LogFormatTab, false
+}
+
+// logJsonLine 决定 json 行中 key 的顺序，它的 json 标签和 LogInfo 一致，所以解析时直接使用 LogInfo
+type logJsonLine struct {
+	CreatedAt string     `json:"created_at"`
+	Tag       string     `json:"tag,omitempty"`
+	Level     LogLevel   `json:"level"`
+	Color     string     `json:"color"`
+	Trace     string     `json:"trace"`
+	Log       string     `json:"log"`
+	Fields    JsonObject `json:"fields,omitempty"`
+	Stack     string     `json:"stack,omitempty"`
+	App       string     `json:"app,omitempty"`
+	Host      string     `json:"host,omitempty"`
+	Pid       int        `json:"pid,omitempty"`
+}
+
+// logfmtKeys 是 logfmt 格式中日志本身使用的 key，和它们同名的结构化字段会加上 "field." 前缀
+var logfmtKeys = map[string]bool{"created_at": true, "tag": true, "level": true, "color": true, "trace": true, "log": true, "stack": true, "app": true, "host": true, "pid": true}
+
+const logfmtFieldPrefix = "field."
+
+// EncodeLogLine 把日志编码为一行文字，结尾包含换行符
+func EncodeLogLine(format LogFormat, li *LogInfo) []byte {
+	switch format {
+	case LogFormatJson:
+		data, err := json.Marshal(&logJsonLine{
+			CreatedAt: li.CreatedAt,
+			Tag:       li.Tag,
+			Level:     li.Level,
+			Color:     li.Color,
+			Trace:     li.Trace,
+			Log:       li.Log,
+			Fields:    li.Fields,
+			Stack:     li.Stack,
+			App:       li.App,
+			Host:      li.Host,
+			Pid:       li.Pid,
+		})
+		if OutputErrorTrace(err, 0) {
+			return nil
+		}
+		return append(data, '\n')
+	case LogFormatLogfmt:
+		var builder strings.Builder
+		builder.WriteString("created_at=")
+		builder.WriteString(logFieldValue(li.CreatedAt))
+		if li.Tag != "" {
+			builder.WriteString(" tag=")
+			builder.WriteString(logFieldValue(li.Tag))
+		}
+		builder.WriteString(" level=")
+		builder.WriteString(li.Level.String())
+		builder.WriteString(" color=")
+		builder.WriteString(logFieldValue(li.Color))
+		builder.WriteString(" trace=")
+		builder.WriteString(logFieldValue(li.Trace))
+		builder.WriteString(" log=")
+		builder.WriteString(logFieldValue(li.Log))
+		if li.Stack != "" {
+			builder.WriteString(" stack=")
+			builder.WriteString(logFieldValue(li.Stack))
+		}
+		if li.App != "" {
+			builder.WriteString(" app=")
+			builder.WriteString(logFieldValue(li.App))
+		}
+		if li.Host != "" {
+			builder.WriteString(" host=")
+			builder.WriteString(logFieldValue(li.Host))
+		}
+		if li.Pid != 0 {
+			builder.WriteString(" pid=")
+			builder.WriteString(strconv.Itoa(li.Pid))
+		}
+		keys := make([]string, 0, len(li.Fields))
+		for k := range li.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			builder.WriteString(" ")
+			if logfmtKeys[k] || strings.HasPrefix(k, logfmtFieldPrefix) {
+				builder.WriteString(logfmtFieldPrefix)
+			}
+			builder.WriteString(k)
+			builder.WriteString("=")
+			builder.WriteString(logFieldValue(li.Fields[k]))
+		}
+		builder.WriteString("\n")
+		return []byte(builder.String())
+	}
+	fields := encodeLogFields(li.Fields)
+	if fields == "" {
+		fields = "{}"
+	}
+	//调用栈是多行的，编码为 json 字串保证一条日志只有一行。没有调用栈时也输出 ""，这样解析时不会把以 json 字串开头的日志当作调用栈
+	stack, _ := json.Marshal(li.Stack)
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n", li.CreatedAt, li.Level, li.Color, li.Trace, fields, stack, li.Log)
+	return []byte(line)
+}
+
+// ParseLogLine 解析 EncodeLogLine 生成的一行日志，格式是自动识别的，所以同一个文件中可以混合不同的格式。
+// 对于 tab 格式，兼容旧版本的 created_at\tcolor\ttrace\tlog 和 created_at\tlevel\tcolor\ttrace\tlog。
+// created_at 不是 "2006-01-02 15:04:05.000" 格式（可以省略毫秒）的行和其它不合法的日志行返回 nil
+func ParseLogLine(line string) *LogInfo {
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "{"):
+		var li LogInfo
+		if json.Unmarshal([]byte(line), &li) != nil || !isLogTime(normalizeLogTime(li.CreatedAt)) {
+			return nil
+		}
+		return &li
+	case strings.HasPrefix(line, "created_at="):
+		return parseLogfmtLine(line)
+	}
+	return parseTabLine(line)
+}
+
+// isLogTime 判断 s 是否是 "2006-01-02 15:04:05" 格式的时间，后面可以有 .000 这样的毫秒。
+// 多行日志的后续行可能包含 tab，检查时间才能把它们和日志行区分开
+func isLogTime(s string) bool {
+	_, err := time.Parse("2006-01-02 15:04:05.999999999", s)
+	return err == nil
+}
+func parseTabLine(line string) *LogInfo {
+	params := strings.SplitN(line, "\t", 6)
+	if len(params) < 4 || !isLogTime(params[0]) {
+		return nil
+	}
+	if level, ok := ParseLogLevel(params[1]); ok && len(params) >= 5 {
+		li := &LogInfo{
+			CreatedAt: params[0],
+			Level:     level,
+			Color:     params[2],
+			Trace:     params[3],
+		}
+		if len(params) == 6 && strings.HasPrefix(params[4], "{") && json.Valid([]byte(params[4])) {
+			li.Fields = decodeLogFields(params[4])
+			li.Log = params[5]
+			if strings.HasPrefix(li.Log, `"`) {
+				//log 之前是 json 字串形式的 stack，没有调用栈时是 ""。
+				//之前的版本在没有调用栈时省略这一列，那时以 json 字串和 tab 开头的日志会被误认为有调用栈
+				if p := strings.SplitN(li.Log, "\t", 2); len(p) == 2 && json.Unmarshal([]byte(p[0]), &li.Stack) == nil {
+					li.Log = p[1]
+				}
+			}
+		} else {
+			li.Log = strings.SplitN(line, "\t", 5)[4]
+		}
+		return li
+	}
+	params = strings.SplitN(line, "\t", 4)
+	return &LogInfo{
+		CreatedAt: params[0],
+		Level:     colorLevel(params[1]),
+		Color:     params[1],
+		Trace:     params[2],
+		Log:       params[3],
+	}
+}
+func parseLogfmtLine(line string) *LogInfo {
+	li := &LogInfo{Level: LevelInfo}
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " ")
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			break
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+		var value string
+		quoted := strings.HasPrefix(line, `"`)
+		if quoted {
+			q, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil
+			}
+			line = line[len(q):]
+			value, _ = strconv.Unquote(q)
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end == -1 {
+				end = len(line)
+			}
+			value = line[:end]
+			line = line[end:]
+		}
+		switch key {
+		case "created_at":
+			li.CreatedAt = value
+		case "tag":
+			li.Tag = value
+		case "level":
+			li.Level, _ = ParseLogLevel(value)
+		case "color":
+			li.Color = value
+		case "trace":
+			li.Trace = value
+		case "log":
+			li.Log = value
+		case "stack":
+			li.Stack = value
+		case "app":
+			li.App = value
+		case "host":
+			li.Host = value
+		case "pid":
+			li.Pid, _ = strconv.Atoi(value)
+		default:
+			if li.Fields == nil {
+				li.Fields = JsonObject{}
+			}
+			key = strings.TrimPrefix(key, logfmtFieldPrefix)
+			li.Fields[key] = logfmtValue(value, quoted)
+		}
+	}
+	if !isLogTime(li.CreatedAt) {
+		return nil
+	}
+	return li
+}
+
+// logfmtValue 尽量恢复字段原来的类型，没有引号的数字和布尔值会被还原，其它的都是字符串
+func logfmtValue(value string, quoted bool) interface{} {
+	if !quoted {
+		var v interface{}
+		if json.Unmarshal([]byte(value), &v) == nil {
+			switch v.(type) {
+			case float64, bool, nil:
+				return v
+			}
+		}
+		return value
+	}
+	if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		var v interface{}
+		if json.Unmarshal([]byte(value), &v) == nil {
+			return v
+		}
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package ju
+
+import (
+	"strings"
+)
+
+// LogLevel 日志级别，数值越大越严重
+type LogLevel int32
+
+const (
+	LevelTrace LogLevel = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelFatal 只是最高的日志级别，记录这个级别的日志不会导致应用退出
+	LevelFatal
+)
+
+const ColorGray = "gray"
+
+var logLevelNames = [...]string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+func (l LogLevel) String() string {
+	if l < LevelTrace || l > LevelFatal {
+		return "info"
+	}
+	return logLevelNames[l]
+}
+
+// MarshalText 让日志级别在 json 中以名称的形式出现，比如 "info"
+func (l LogLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText 解析日志级别名称，不能识别的名称解析为 LevelInfo
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	lv, ok := ParseLogLevel(string(text))
+	if !ok {
+		lv = LevelInfo
+	}
+	*l = lv
+	return nil
+}
+
+// ParseLogLevel 解析日志级别名称，不区分大小写，"warning" 等同于 "warn"
+func ParseLogLevel(s string) (LogLevel, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		return LevelWarn, true
+	}
+	for i, name := range logLevelNames {
+		if s == name {
+			return LogLevel(i), true
+		}
+	}
+	return LevelInfo, false
+}
+
+// LevelColor 返回日志级别缺省对应的颜色
+func LevelColor(level LogLevel) string {
+	switch level {
+	case LevelTrace:
+		return ColorGray
+	case LevelDebug:
+		return ColorCyan
+	case LevelWarn:
+		return ColorYellow
+	case LevelError:
+		return ColorRed
+	case LevelFatal:
+		return ColorMagenta
+	}
+	return ColorGreen
+}
+
+// colorLevel 是颜色类日志函数（LogRed 等）对应的日志级别，红色是错误，黄色是警告，其它都是普通信息
+func colorLevel(color string) LogLevel {
+	switch color {
+	case ColorRed:
+		return LevelError
+	case ColorYellow:
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// SetLogLevel 设置缺省 Logger 的最低日志级别，低于这个级别的日志会被直接丢弃，不会输出到控制台，也不会存储到数据库。
+// 缺省值是 LevelTrace，也就是记录所有日志。这个函数可以在运行时随时调用。
+func SetLogLevel(level LogLevel) {
+	std().SetLevel(level)
+}
+
+// GetLogLevel 返回缺省 Logger 的最低日志级别
+func GetLogLevel() LogLevel {
+	return std().GetLevel()
+}
+
+// SetTagLogLevel 单独设置某个 tag 的最低日志级别，它优先于 SetLogLevel 的设置，缺省日志的 tag 是空串
+func SetTagLogLevel(tag string, level LogLevel) {
+	std().SetTagLevel(tag, level)
+}
+
+// ResetTagLogLevel 移除 SetTagLogLevel 的设置，这个 tag 恢复使用全局的日志级别
+func ResetTagLogLevel(tag string) {
+	std().ResetTagLevel(tag)
+}
+
+// LogLevelEnabled 返回指定级别的日志在 tag 下是否会被缺省 Logger 记录
+func LogLevelEnabled(level LogLevel, tag string) bool {
+	return std().LevelEnabled(level, tag)
+}
@@ -0,0 +1,143 @@
+package ju
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLimitKey 决定哪些日志算作同一类，频率限制分别统计每一类日志
+type LogLimitKey int
+
+const (
+	// LogLimitByTrace 按记录的位置（tag 和 trace）统计，同一行代码记录的日志是一类，不管内容是否相同
+	LogLimitByTrace LogLimitKey = iota
+	// LogLimitByMessage 按内容（tag 和日志内容）统计，内容相同的日志是一类，不管在哪里记录
+	LogLimitByMessage
+)
+
+// LogLimit 是日志的频率限制，同一类日志在每个 Interval 内最多记录 Burst 条，多出的日志被丢弃，
+// 这个时间段结束后记录一条 "message repeated N times: 日志" 的汇总日志，它的字段 repeated 是丢弃的条数。
+type LogLimit struct {
+	// Burst 每个时间段内同一类日志最多记录的条数
+	Burst int
+	// Interval 统计的时间段
+	Interval time.Duration
+	// Key 日志的分类方式
+	Key LogLimitKey
+}
+
+type logLimitState struct {
+	start      time.Time
+	count      int
+	suppressed int
+	logger     *Logger
+	level      LogLevel
+	color      string
+	tag        string
+	trace      string
+	msg        string
+}
+
+type logLimiter struct {
+	mu     sync.Mutex
+	opt    LogLimit
+	states map[string]*logLimitState
+	done   chan struct{}
+}
+
+var logLimit atomic.Pointer[logLimiter]
+
+// SetLogLimit 设置 Log 类函数和 SlogHandler 的频率限制，limit 为 nil，或者 Burst, Interval <= 0 时取消限制。
+// 频率限制在日志写入存储和输出到控制台之前检查，所以被丢弃的日志不会占用数据库的条数上限。
+// 重新设置时，之前丢弃的日志会立即记录汇总日志。
+// noinspection GoUnusedExportedFunction
+func SetLogLimit(limit *LogLimit) {
+	var l *logLimiter
+	if limit != nil && limit.Burst > 0 && limit.Interval > 0 {
+		l = &logLimiter{opt: *limit, states: map[string]*logLimitState{}, done: make(chan struct{})}
+		go l.run()
+	}
+	if old := logLimit.Swap(l); old != nil {
+		close(old.done)
+		old.sweep(true)
+	}
+}
+
+// logLimitAllow 判断日志是否可以记录，被丢弃时返回 false
+func logLimitAllow(logger *Logger, level LogLevel, color, tag, trace, msg string) bool {
+	l := logLimit.Load()
+	if l == nil {
+		return true
+	}
+	key := tag + "\x00" + trace
+	if l.opt.Key == LogLimitByMessage {
+		key = tag + "\x00" + msg
+	}
+	now := time.Now()
+	var summary *logLimitState
+	l.mu.Lock()
+	st := l.states[key]
+	if st == nil {
+		st = &logLimitState{start: now}
+		l.states[key] = st
+	} else if now.Sub(st.start) >= l.opt.Interval {
+		if st.suppressed > 0 {
+			s := *st
+			summary = &s
+		}
+		*st = logLimitState{start: now}
+	}
+	st.count++
+	allow := st.count <= l.opt.Burst
+	if !allow {
+		st.suppressed++
+		st.logger, st.level, st.color, st.tag, st.trace, st.msg = logger, level, color, tag, trace, msg
+	}
+	l.mu.Unlock()
+
+	if summary != nil {
+		summary.log()
+	}
+	return allow
+}
+
+// run 定时记录已经结束的时间段的汇总日志，并且删除不再使用的统计
+func (l *logLimiter) run() {
+	ticker := time.NewTicker(l.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.sweep(false)
+		}
+	}
+}
+
+// sweep 删除时间段已经结束的统计，all 为 true 时删除全部统计，有丢弃日志的记录汇总日志
+func (l *logLimiter) sweep(all bool) {
+	now := time.Now()
+	var summaries []logLimitState
+	l.mu.Lock()
+	for key, st := range l.states {
+		if all || now.Sub(st.start) >= l.opt.Interval {
+			if st.suppressed > 0 {
+				summaries = append(summaries, *st)
+			}
+			delete(l.states, key)
+		}
+	}
+	l.mu.Unlock()
+	for i := range summaries {
+		summaries[i].log()
+	}
+}
+
+// log 记录汇总日志，它不受频率限制
+func (st *logLimitState) log() {
+	msg := fmt.Sprintf("message repeated %d times: %s", st.suppressed, st.msg)
+	st.logger.config().logTrace(2, st.trace, "", st.level, st.color, st.tag, JsonObject{"repeated": st.suppressed}, msg)
+}
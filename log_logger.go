@@ -0,0 +1,320 @@
+package ju
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loggerConfig 是 Logger 的设置，它是不可修改的，修改设置时复制一份新的替换旧的，所以记录日志时不需要加锁
+type loggerConfig struct {
+	db              LogDb
+	slog            slog.Handler
+	output          bool
+	format          LogFormat
+	maxLogCount     int64
+	maxMainLogCount int64
+	tag             string
+	level           LogLevel
+	tagLevels       map[string]LogLevel
+	writer          io.Writer
+	colorMode       LogColorMode
+	prefix          LogPrefixFunc
+	// colored 是根据 colorMode 和 writer 计算出的是否使用颜色
+	colored bool
+}
+
+// Logger 是独立的日志记录器，它有自己的日志存储、控制台输出、条数上限、日志级别和缺省 tag，
+// 库和测试可以使用自己的 Logger，不影响应用的日志设置。Log 类函数使用 DefaultLogger 返回的缺省 Logger。
+// Logger 的所有方法都可以在记录日志的同时并发调用。频率限制（SetLogLimit）、采样（SetLogSampling）和订阅（SubscribeLogs）是所有 Logger 共用的。
+type Logger struct {
+	mu  sync.Mutex
+	cfg atomic.Pointer[loggerConfig]
+}
+
+// NewLogger 创建一个 Logger，参数的含义和 SetLogParam 相同，日志级别是 LevelTrace，缺省 tag 是空串
+// noinspection GoUnusedExportedFunction
+func NewLogger(db LogDb, output bool, maxLogCount, maxMainLogCount int64) *Logger {
+	l := &Logger{}
+	l.cfg.Store(&loggerConfig{})
+	l.SetParam(db, output, maxLogCount, maxMainLogCount)
+	return l
+}
+
+var defaultLogger atomic.Pointer[Logger]
+
+func init() {
+	defaultLogger.Store(NewLogger(nil, true, 1000, 10000))
+}
+
+// DefaultLogger 返回 Log 类函数使用的缺省 Logger
+// noinspection GoUnusedExportedFunction
+func DefaultLogger() *Logger {
+	return defaultLogger.Load()
+}
+
+// SetDefaultLogger 替换 Log 类函数使用的缺省 Logger，l 为 nil 时什么都不做，返回原来的 Logger。
+// 测试中可以临时替换为自己的 Logger，结束后再恢复
+// noinspection GoUnusedExportedFunction
+func SetDefaultLogger(l *Logger) *Logger {
+	if l == nil {
+		return defaultLogger.Load()
+	}
+	return defaultLogger.Swap(l)
+}
+
+// std 是 DefaultLogger 的简写
+func std() *Logger {
+	return defaultLogger.Load()
+}
+
+func (l *Logger) config() *loggerConfig {
+	return l.cfg.Load()
+}
+
+// update 复制当前的设置，修改以后替换原来的设置
+func (l *Logger) update(fn func(c *loggerConfig)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := *l.cfg.Load()
+	fn(&c)
+	c.colored = c.useColor()
+	l.cfg.Store(&c)
+}
+
+// logCapsSetter 是使用日志条数上限的存储实现的接口，SetParam 通过它把上限设置到存储中
+type logCapsSetter interface {
+	setLogCaps(maxLogCount, maxMainLogCount int64)
+}
+
+// SetParam 设置日志存储、是否输出到控制台和数据库日志的条数上限，参数的含义见 SetLogParam
+func (l *Logger) SetParam(db LogDb, output bool, maxLogCount, maxMainLogCount int64) {
+	l.update(func(c *loggerConfig) {
+		c.db = db
+		c.output = output
+		c.maxLogCount = maxLogCount
+		c.maxMainLogCount = maxMainLogCount
+	})
+	if cs, ok := db.(logCapsSetter); ok {
+		cs.setLogCaps(maxLogCount, maxMainLogCount)
+	}
+}
+
+// SetConsoleFormat 设置控制台输出的格式，见 SetLogConsoleFormat
+func (l *Logger) SetConsoleFormat(format LogFormat) {
+	l.update(func(c *loggerConfig) {
+		c.format = format
+	})
+}
+
+// SetSlogHandler 让日志通过 h 输出，代替控制台输出，见 SetLogSlogHandler
+func (l *Logger) SetSlogHandler(h slog.Handler) {
+	l.update(func(c *loggerConfig) {
+		c.slog = h
+	})
+}
+
+// SetTag 设置缺省 tag，Logger 不带 tag 参数的方法记录到这个 tag
+func (l *Logger) SetTag(tag string) {
+	l.update(func(c *loggerConfig) {
+		c.tag = tag
+	})
+}
+
+// GetTag 返回缺省 tag
+func (l *Logger) GetTag() string {
+	return l.config().tag
+}
+
+// SetLevel 设置最低日志级别，见 SetLogLevel
+func (l *Logger) SetLevel(level LogLevel) {
+	l.update(func(c *loggerConfig) {
+		c.level = level
+	})
+}
+
+// GetLevel 返回最低日志级别
+func (l *Logger) GetLevel() LogLevel {
+	return l.config().level
+}
+
+// SetTagLevel 单独设置 tag 的最低日志级别，见 SetTagLogLevel
+func (l *Logger) SetTagLevel(tag string, level LogLevel) {
+	l.update(func(c *loggerConfig) {
+		tags := make(map[string]LogLevel, len(c.tagLevels)+1)
+		for k, v := range c.tagLevels {
+			tags[k] = v
+		}
+		tags[tag] = level
+		c.tagLevels = tags
+	})
+}
+
+// ResetTagLevel 移除 SetTagLevel 的设置
+func (l *Logger) ResetTagLevel(tag string) {
+	l.update(func(c *loggerConfig) {
+		tags := make(map[string]LogLevel, len(c.tagLevels))
+		for k, v := range c.tagLevels {
+			if k != tag {
+				tags[k] = v
+			}
+		}
+		c.tagLevels = tags
+	})
+}
+
+// LevelEnabled 返回指定级别的日志在 tag 下是否会被记录
+func (l *Logger) LevelEnabled(level LogLevel, tag string) bool {
+	return l.config().enabled(level, tag)
+}
+
+// Flush 让日志存储立即写入缓冲和队列中的日志，见 FlushLogs
+func (l *Logger) Flush() {
+	if f, ok := l.config().db.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// Entry 返回使用这个 Logger 记录到 tag 的 LogEntry
+func (l *Logger) Entry(tag string) *LogEntry {
+	return &LogEntry{logger: l, tag: tag}
+}
+
+// With 返回使用这个 Logger 记录到缺省 tag 的 LogEntry，并添加字段，参数和 LogEntry.With 相同
+func (l *Logger) With(kv ...interface{}) *LogEntry {
+	return l.Entry(l.GetTag()).With(kv...)
+}
+
+// SlogHandler 返回使用这个 Logger 记录到 tag 的 slog.Handler
+func (l *Logger) SlogHandler(tag string) *SlogHandler {
+	return &SlogHandler{logger: l, tag: tag}
+}
+
+func (l *Logger) Trace(v ...interface{}) {
+	l.logStack(3, false, nil, LevelTrace, LevelColor(LevelTrace), l.GetTag(), nil, v...)
+}
+func (l *Logger) Debug(v ...interface{}) {
+	l.logStack(3, false, nil, LevelDebug, LevelColor(LevelDebug), l.GetTag(), nil, v...)
+}
+func (l *Logger) Info(v ...interface{}) {
+	l.logStack(3, false, nil, LevelInfo, LevelColor(LevelInfo), l.GetTag(), nil, v...)
+}
+func (l *Logger) Warn(v ...interface{}) {
+	l.logStack(3, false, nil, LevelWarn, LevelColor(LevelWarn), l.GetTag(), nil, v...)
+}
+func (l *Logger) Error(v ...interface{}) {
+	l.logStack(3, false, nil, LevelError, LevelColor(LevelError), l.GetTag(), nil, v...)
+}
+func (l *Logger) Fatal(v ...interface{}) {
+	l.logStack(3, false, nil, LevelFatal, LevelColor(LevelFatal), l.GetTag(), nil, v...)
+}
+
+// Color 以指定颜色记录到缺省 tag，级别由颜色决定，skip 的含义和 LogColor 相同
+func (l *Logger) Color(skip int, color string, v ...interface{}) {
+	l.logStack(3+skip, false, nil, colorLevel(color), color, l.GetTag(), nil, v...)
+}
+
+// ColorTo 以指定颜色记录到 tag，级别由颜色决定，skip 的含义和 LogColor 相同
+func (l *Logger) ColorTo(skip int, color, tag string, v ...interface{}) {
+	l.logStack(3+skip, false, nil, colorLevel(color), color, tag, nil, v...)
+}
+
+// Fail 和 LogFail 相同，err 不是 nil 时记录到缺省 tag 并返回 true
+func (l *Logger) Fail(err error) bool {
+	if err != nil {
+		l.logStack(3, errorStack.Load(), err, LevelError, ColorRed, l.GetTag(), nil, err.Error())
+		return true
+	}
+	return false
+}
+
+// logStack 是所有日志函数的最终实现，fields 是附加在日志上的结构化字段，可以是 nil。
+// withStack 为 true 时记录完整的调用栈，err 不为 nil 时调用栈之前还有 err 包装的错误链
+func (l *Logger) logStack(skip int, withStack bool, err error, level LogLevel, color, tag string, fields JsonObject, v ...interface{}) {
+	c := l.config()
+	if !c.enabled(level, tag) {
+		return
+	}
+	trace := GetTrace(skip)
+	msg := logMessage(v)
+	if !logLimitAllow(l, level, color, tag, trace, msg) {
+		return
+	}
+	var stack string
+	if withStack {
+		stack = captureStack(skip, err)
+	}
+	c.logTrace(skip+1, trace, stack, level, color, tag, fields, msg)
+}
+
+// logMessage 把参数用空格连接为日志内容
+func logMessage(v []interface{}) string {
+	var builder strings.Builder
+	for i, value := range v {
+		if i > 0 {
+			builder.WriteString(" ")
+		}
+		builder.WriteString(fmt.Sprint(value))
+	}
+	return builder.String()
+}
+
+func (c *loggerConfig) enabled(level LogLevel, tag string) bool {
+	if lv, ok := c.tagLevels[tag]; ok {
+		return level >= lv
+	}
+	return level >= c.level
+}
+
+// logTrace 使用指定的 trace 和 stack 记录日志，不检查日志级别和频率限制，skip 比 logStack 的多一层，用于转发给 slog 时确定调用位置
+func (c *loggerConfig) logTrace(skip int, trace, stack string, level LogLevel, color, tag string, fields JsonObject, msg string) {
+	li := &LogInfo{
+		Tag:       tag,
+		Level:     level,
+		Color:     color,
+		Log:       msg,
+		Trace:     trace,
+		Fields:    fields,
+		Stack:     stack,
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05.000"),
+	}
+	c.logInfo(skip+1, li, true)
+}
+
+// logInfo 保存并输出 li，sample 为 false 时不经过 SetLogSampling 的采样，skip 和 logTrace 的相同
+func (c *loggerConfig) logInfo(skip int, li *LogInfo, sample bool) {
+	c.saveLog(li, sample)
+	if c.slog != nil {
+		forwardSlog(c.slog, skip, li)
+	} else {
+		c.outputLog(li)
+	}
+}
+
+// saveLog 把日志保存到设置的 LogDb（sample 为 true 时 SetLogSampling 采样掉的日志除外），并且发送给订阅者
+func (c *loggerConfig) saveLog(li *LogInfo, sample bool) {
+	if c.db != nil && (!sample || logSampled(li)) {
+		c.db.SaveLog(li)
+	}
+	publishLog(li)
+}
+
+// outputLog 按 SetLogConsoleFormat 设置的格式把日志输出到 SetLogConsoleWriter 设置的控制台
+func (c *loggerConfig) outputLog(li *LogInfo) {
+	if !c.output {
+		return
+	}
+	if c.format != LogFormatTab {
+		c.writeRaw(EncodeLogLine(c.format, li))
+		return
+	}
+	str := li.Log
+	if len(li.Fields) > 0 {
+		str += " " + li.Fields.logString()
+	}
+	c.writeConsole(li, str, li.Stack, true)
+}
@@ -0,0 +1,119 @@
+package ju
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// PanicOption 设置 Recover 和 Go 捕获 panic 之后的处理
+type PanicOption struct {
+	// RePanic 记录日志之后重新 panic，一般会导致程序退出，但是日志已经写入存储了
+	RePanic bool
+	// OnPanic 在记录日志之后调用，v 是 recover 的值，stack 是 panic 时的调用栈
+	OnPanic func(tag string, v any, stack []byte)
+}
+
+// panicOption 是 SetPanicOption 的设置，nil 表示只记录日志
+var panicOption atomic.Pointer[PanicOption]
+
+// SetPanicOption 设置 Recover 和 Go 的缺省处理，可以在任何时候设置，已经开始处理的 panic 使用之前的设置
+// noinspection GoUnusedExportedFunction
+func SetPanicOption(opt PanicOption) {
+	panicOption.Store(&opt)
+}
+
+// Recover 捕获 panic 并记录到 tag，必须直接使用 defer 调用，比如：
+//
+//	defer ju.Recover("worker")
+//
+// 日志的级别是 LevelFatal，内容是 panic 的值，完整的调用栈保存在 LogInfo.Stack 中，trace 是 panic 发生的位置。
+// panic 日志不受日志级别、SetLogLimit 和 SetLogSampling 的限制，记录之后会调用 FlushLogs，保证缓冲中的日志写入存储。之后的处理由 SetPanicOption 决定。
+// noinspection GoUnusedExportedFunction
+func Recover(tag string) {
+	if v := recover(); v != nil {
+		handlePanic(tag, panicOption.Load(), v)
+	}
+}
+
+// RecoverWith 和 Recover 相同，但是使用 opt 代替 SetPanicOption 的设置，opt 为 nil 时只记录日志
+// noinspection GoUnusedExportedFunction
+func RecoverWith(tag string, opt *PanicOption) {
+	if v := recover(); v != nil {
+		handlePanic(tag, opt, v)
+	}
+}
+
+// Go 在新的 goroutine 中运行 fn，fn 中的 panic 会被 Recover 记录到缺省日志，而不是只输出到 stderr
+// noinspection GoUnusedExportedFunction
+func Go(fn func()) {
+	GoTo("", fn)
+}
+
+// GoTo 和 Go 相同，panic 记录到 tag
+// noinspection GoUnusedExportedFunction
+func GoTo(tag string, fn func()) {
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				handlePanic(tag, panicOption.Load(), v)
+			}
+		}()
+		fn()
+	}()
+}
+
+// FlushLogs 让 SetLogParam 设置的 LogDb 立即写入缓冲和队列中的日志，LogDb 没有 Flush 方法时什么都不做。
+// 程序退出之前应该调用它，否则 FileLogDb 和异步模式的数据库最后一段时间的日志可能丢失
+func FlushLogs() {
+	std().Flush()
+}
+
+func handlePanic(tag string, opt *PanicOption, v any) {
+	stack := debug.Stack()
+	li := &LogInfo{
+		Tag:       tag,
+		Level:     LevelFatal,
+		Color:     LevelColor(LevelFatal),
+		Log:       fmt.Sprintf("panic: %v", v),
+		Trace:     panicTrace(),
+		Stack:     string(stack),
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05.000"),
+	}
+	//panic 日志不受频率限制，也不参与采样
+	std().config().logInfo(3, li, false)
+	FlushLogs()
+	if opt == nil {
+		return
+	}
+	if opt.OnPanic != nil {
+		opt.OnPanic(tag, v, stack)
+	}
+	if opt.RePanic {
+		panic(v)
+	}
+}
+
+// panicTrace 返回 panic 发生的位置，也就是调用栈中 runtime.gopanic 之后的第一个不是 runtime 的函数
+func panicTrace() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		} else if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", path.Base(frame.File), frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return GetTrace(3)
+}
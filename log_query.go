@@ -0,0 +1,187 @@
+package ju
+
+import (
+	"strings"
+)
+
+// LogQuery 是 QueryLogs 的查询条件，所有条件都是可选的，零值查询全部日志的最新 100 条
+type LogQuery struct {
+	// Tags 查询这些 tag 的日志，为空时查询所有 tag，缺省日志的 tag 是空串
+	Tags []string
+	// Levels 只返回这些级别的日志，为空时不限制
+	Levels []LogLevel
+	// Colors 只返回这些颜色的日志，为空时不限制
+	Colors []string
+	// Since 只返回 created_at >= Since 的日志，格式是 "2006-01-02 15:04:05.000"，可以省略后面的部分
+	Since string
+	// Until 只返回 created_at <= Until 的日志
+	Until string
+	// Trace 只返回 trace 中包含这个字串的日志
+	Trace string
+	// Text 只返回 log 中包含这个字串的日志
+	Text string
+	// App, Host, Pid 只返回这个进程写入的日志，为零值时不限制，只有 SQL 存储记录这些信息，见 SqlLogOption
+	App  string
+	Host string
+	Pid  int
+	// Limit 最多返回的条数，缺省值是 100
+	Limit int
+	// Cursor 从这个位置继续查询，它是上一次查询返回的 next，为 nil 时从最新的日志开始
+	Cursor *LogCursor
+}
+
+// LogCursor 是日志查询的位置，查询结果按 (created_at, id) 从新到旧排列，下一页从严格早于 cursor 的日志开始。
+// 和 page 分页不同，它不需要数据库跳过前面的记录，所以翻页的速度和页数无关，也不受新增日志的影响。
+type LogCursor struct {
+	CreatedAt string `json:"created_at"`
+	Id        int64  `json:"id"`
+}
+
+func (q *LogQuery) limit() int {
+	if q.Limit <= 0 {
+		return 100
+	}
+	return q.Limit
+}
+
+// sqlWhere 生成查询条件，使用 ? 作为参数占位符，返回的 where 包含 WHERE 关键字，没有条件时是空串
+func (q *LogQuery) sqlWhere() (where string, args []any) {
+	var conds []string
+	in := func(column string, n int) string {
+		return column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", n), ",") + ")"
+	}
+	if len(q.Tags) > 0 {
+		conds = append(conds, in("tag", len(q.Tags)))
+		for _, tag := range q.Tags {
+			args = append(args, tag)
+		}
+	}
+	if len(q.Levels) > 0 {
+		conds = append(conds, in("level", len(q.Levels)))
+		for _, level := range q.Levels {
+			args = append(args, level)
+		}
+	}
+	if len(q.Colors) > 0 {
+		conds = append(conds, in("color", len(q.Colors)))
+		for _, color := range q.Colors {
+			args = append(args, color)
+		}
+	}
+	if q.Since != "" {
+		conds = append(conds, "created_at>=?")
+		args = append(args, q.Since)
+	}
+	if q.Until != "" {
+		conds = append(conds, "created_at<=?")
+		args = append(args, q.Until)
+	}
+	if q.Trace != "" {
+		conds = append(conds, "trace LIKE ? ESCAPE '!'")
+		args = append(args, "%"+escapeLike(q.Trace)+"%")
+	}
+	if q.Text != "" {
+		conds = append(conds, "log LIKE ? ESCAPE '!'")
+		args = append(args, "%"+escapeLike(q.Text)+"%")
+	}
+	if q.App != "" {
+		conds = append(conds, "app=?")
+		args = append(args, q.App)
+	}
+	if q.Host != "" {
+		conds = append(conds, "host=?")
+		args = append(args, q.Host)
+	}
+	if q.Pid != 0 {
+		conds = append(conds, "pid=?")
+		args = append(args, q.Pid)
+	}
+	if q.Cursor != nil {
+		createdAt := normalizeLogTime(q.Cursor.CreatedAt)
+		conds = append(conds, "(created_at<? OR (created_at=? AND id<?))")
+		args = append(args, createdAt, createdAt, q.Cursor.Id)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, "!", "!!")
+	s = strings.ReplaceAll(s, "%", "!%")
+	return strings.ReplaceAll(s, "_", "!_")
+}
+
+// match 判断日志是否满足除 Tags 和 Cursor 之外的条件，用于不能使用 sql 查询的存储
+func (q *LogQuery) match(li *LogInfo) bool {
+	if len(q.Levels) > 0 {
+		found := false
+		for _, level := range q.Levels {
+			if li.Level == level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Colors) > 0 {
+		found := false
+		for _, color := range q.Colors {
+			if li.Color == color {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Since != "" && li.CreatedAt < q.Since {
+		return false
+	}
+	if q.Until != "" && li.CreatedAt > q.Until {
+		return false
+	}
+	if q.Trace != "" && !strings.Contains(li.Trace, q.Trace) {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(li.Log, q.Text) {
+		return false
+	}
+	if (q.App != "" && li.App != q.App) || (q.Host != "" && li.Host != q.Host) || (q.Pid != 0 && li.Pid != q.Pid) {
+		return false
+	}
+	return true
+}
+
+// before 判断日志是否严格早于 cursor
+func (c *LogCursor) before(li *LogInfo) bool {
+	createdAt := normalizeLogTime(c.CreatedAt)
+	return li.CreatedAt < createdAt || (li.CreatedAt == createdAt && int64(li.Id) < c.Id)
+}
+
+// normalizeLogTime 把 "2006-01-02T15:04:05.000Z" 这样的时间转换为日志使用的 "2006-01-02 15:04:05.000" 格式，
+// 一些数据库驱动会把 DATETIME 转换为这种格式，其它格式原样返回
+func normalizeLogTime(s string) string {
+	if len(s) < 19 || s[10] != 'T' {
+		return s
+	}
+	s = s[:10] + " " + s[11:]
+	if i := strings.IndexAny(s[19:], "Z+-"); i >= 0 {
+		s = s[:19+i]
+	}
+	return s
+}
+
+// pageLogs 处理多查询了一条的结果，如果多出的一条存在，说明还有下一页，返回下一页的 cursor，否则 next 是 nil
+func pageLogs(logs []*LogInfo, limit int) ([]*LogInfo, *LogCursor) {
+	if len(logs) <= limit {
+		return logs, nil
+	}
+	logs = logs[:limit]
+	last := logs[limit-1]
+	return logs, &LogCursor{CreatedAt: last.CreatedAt, Id: int64(last.Id)}
+}
@@ -0,0 +1,68 @@
+package ju
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// LogSampling 是日志的采样设置，被采样掉的日志不保存到 SetLogParam 设置的 LogDb，但是仍然输出到控制台，也会发送给订阅者。
+// Every 和 Rate 只需要设置一个，都设置时使用 Every
+type LogSampling struct {
+	// Every 每 Every 条日志保存一条，保存的是第 1, Every+1, 2*Every+1... 条
+	Every int64
+	// Rate 每条日志被保存的概率，取值 0 到 1
+	Rate float64
+}
+
+type logSampleKey struct {
+	tag   string
+	level LogLevel
+}
+
+type logSampler struct {
+	LogSampling
+	count atomic.Int64
+}
+
+var logSamplers = struct {
+	mu    sync.RWMutex
+	count atomic.Int32
+	list  map[logSampleKey]*logSampler
+}{list: map[logSampleKey]*logSampler{}}
+
+// SetLogSampling 设置 tag 中 level 级别日志的采样，s 为 nil 时取消采样，比如只保存 1/10 的请求日志：
+//
+//	ju.SetLogSampling("request", ju.LevelInfo, &ju.LogSampling{Every: 10})
+//
+// 每个级别需要单独设置，一般只对 LevelInfo 及以下的日志采样，保证错误日志全部被保存。
+// 采样和 SetLogLimit 的频率限制是独立的，先检查频率限制，被限制的日志不参与采样的计数。
+// noinspection GoUnusedExportedFunction
+func SetLogSampling(tag string, level LogLevel, s *LogSampling) {
+	key := logSampleKey{tag: tag, level: level}
+	logSamplers.mu.Lock()
+	defer logSamplers.mu.Unlock()
+	if s == nil {
+		delete(logSamplers.list, key)
+	} else {
+		logSamplers.list[key] = &logSampler{LogSampling: *s}
+	}
+	logSamplers.count.Store(int32(len(logSamplers.list)))
+}
+
+// logSampled 判断日志是否需要保存到 LogDb
+func logSampled(li *LogInfo) bool {
+	if logSamplers.count.Load() == 0 {
+		return true
+	}
+	logSamplers.mu.RLock()
+	sampler := logSamplers.list[logSampleKey{tag: li.Tag, level: li.Level}]
+	logSamplers.mu.RUnlock()
+	if sampler == nil {
+		return true
+	}
+	if sampler.Every > 0 {
+		return (sampler.count.Add(1)-1)%sampler.Every == 0
+	}
+	return rand.Float64() < sampler.Rate
+}
@@ -0,0 +1,239 @@
+package ju
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// SlogHandler 是使用 ju 日志的 slog.Handler，slog 的日志和 Log 类函数的日志一样输出到控制台，保存到 SetLogParam 设置的 LogDb，
+// 受 SetLogLevel 设置的级别控制。slog 的级别转换为 LogLevel，颜色是级别的缺省颜色，属性保存为日志字段，分组的属性名是 "group.key" 的形式，
+// context 中 ContextWithLogFields 附加的字段也会被记录。
+type SlogHandler struct {
+	// logger 是记录日志的 Logger，nil 表示缺省 Logger
+	logger *Logger
+	tag    string
+	attrs  []slog.Attr
+	// prefix 是当前分组的前缀，比如 "a.b."
+	prefix string
+}
+
+// NewSlogHandler 创建记录到 tag 的 slog.Handler，比如：
+//
+//	slog.SetDefault(slog.New(ju.NewSlogHandler("")))
+//
+// noinspection GoUnusedExportedFunction
+func NewSlogHandler(tag string) *SlogHandler {
+	return &SlogHandler{tag: tag}
+}
+
+func (h *SlogHandler) getLogger() *Logger {
+	if h.logger == nil {
+		return std()
+	}
+	return h.logger
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.getLogger().LevelEnabled(SlogLevelToLogLevel(level), h.tag)
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	l := h.getLogger()
+	c := l.config()
+	if ctx != nil {
+		//Log 类函数通过 SetLogSlogHandler 转发过来的日志已经保存过了，这里只输出原来的日志
+		if li, ok := ctx.Value(slogForwardKey{}).(*LogInfo); ok {
+			c.outputLog(li)
+			return nil
+		}
+	}
+	level := SlogLevelToLogLevel(r.Level)
+	trace := pcTrace(r.PC)
+	if !logLimitAllow(l, level, LevelColor(level), h.tag, trace, r.Message) {
+		return nil
+	}
+	fields := JsonObject{}
+	for k, v := range LogFieldsFromContext(ctx) {
+		fields[k] = v
+	}
+	for _, a := range h.attrs {
+		addSlogAttr(fields, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(fields, h.prefix, a)
+		return true
+	})
+	if len(fields) == 0 {
+		fields = nil
+	}
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	li := &LogInfo{
+		Tag:       h.tag,
+		Level:     level,
+		Color:     LevelColor(level),
+		Log:       r.Message,
+		Trace:     trace,
+		Fields:    fields,
+		CreatedAt: t.Format("2006-01-02 15:04:05.000"),
+	}
+	c.saveLog(li, true)
+	c.outputLog(li)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	nh := *h
+	nh.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	nh.attrs = append(nh.attrs, h.attrs...)
+	for _, a := range attrs {
+		//先加上当前分组的前缀，这样之后的 WithGroup 不会影响它们
+		if h.prefix != "" {
+			a = slog.Attr{Key: h.prefix + a.Key, Value: a.Value}
+		}
+		nh.attrs = append(nh.attrs, a)
+	}
+	return &nh
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	nh := *h
+	nh.prefix = h.prefix + name + "."
+	return &nh
+}
+
+// addSlogAttr 把属性添加到字段中，分组的属性展开为 "group.key"
+func addSlogAttr(fields JsonObject, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addSlogAttr(fields, prefix, ga)
+		}
+		return
+	}
+	var value interface{}
+	switch a.Value.Kind() {
+	case slog.KindTime:
+		value = a.Value.Time().Format("2006-01-02 15:04:05.000")
+	case slog.KindDuration:
+		value = a.Value.Duration().String()
+	default:
+		value = a.Value.Any()
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+	}
+	fields[prefix+a.Key] = value
+}
+
+// pcTrace 把 slog 记录的调用位置转换为 GetTrace 的格式
+func pcTrace(pc uintptr) string {
+	if pc == 0 {
+		return "unknown:0"
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return "unknown:0"
+	}
+	return fmt.Sprintf("%s:%d", path.Base(frame.File), frame.Line)
+}
+
+// SlogLevelToLogLevel 把 slog 的级别转换为 LogLevel，低于 Debug 的是 LevelTrace，Error+4 及以上是 LevelFatal
+func SlogLevelToLogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelDebug:
+		return LevelTrace
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	case level < slog.LevelError+4:
+		return LevelError
+	}
+	return LevelFatal
+}
+
+// LogLevelToSlogLevel 把 LogLevel 转换为 slog 的级别，LevelTrace 是 Debug-4，LevelFatal 是 Error+4
+func LogLevelToSlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelTrace:
+		return slog.LevelDebug - 4
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	case LevelFatal:
+		return slog.LevelError + 4
+	}
+	return slog.LevelInfo
+}
+
+// slogForwardKey 是转发给 slog.Handler 的 context 中保存原始 LogInfo 的 key，SlogHandler 用它避免重复保存日志
+type slogForwardKey struct{}
+
+// SetLogSlogHandler 让 Log 类函数通过 h 输出日志，代替控制台输出，h 为 nil 时恢复控制台输出。
+// 日志仍然会保存到 SetLogParam 设置的 LogDb，h 的输出和 SetLogParam 的 output 参数无关。
+// 日志的 tag, color, trace, stack 和字段作为属性传给 h，tag 和 stack 为空串时没有对应的属性。
+// noinspection GoUnusedExportedFunction
+func SetLogSlogHandler(h slog.Handler) {
+	std().SetSlogHandler(h)
+}
+
+// forwardSlog 把日志转换为 slog.Record 交给 h 处理，skip 和 logFields 的相同，用于设置记录的调用位置
+func forwardSlog(h slog.Handler, skip int, li *LogInfo) {
+	ctx := context.WithValue(context.Background(), slogForwardKey{}, li)
+	level := LogLevelToSlogLevel(li.Level)
+	if !h.Enabled(ctx, level) {
+		return
+	}
+	//runtime.Callers 的 1 是 forwardSlog，比 logFields 中的 GetTrace 多一层
+	var pcs [1]uintptr
+	runtime.Callers(skip+1, pcs[:])
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.000", li.CreatedAt, time.Local)
+	if err != nil {
+		t = time.Now()
+	}
+	r := slog.NewRecord(t, level, li.Log, pcs[0])
+	if li.Tag != "" {
+		r.AddAttrs(slog.String("tag", li.Tag))
+	}
+	r.AddAttrs(slog.String("color", li.Color), slog.String("trace", li.Trace))
+	if li.Stack != "" {
+		r.AddAttrs(slog.String("stack", li.Stack))
+	}
+	keys := make([]string, 0, len(li.Fields))
+	for k := range li.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.AddAttrs(slog.Any(k, li.Fields[k]))
+	}
+	err = h.Handle(ctx, r)
+	if err != nil {
+		OutputColor(0, ColorRed, "slog handler:", err)
+	}
+}
@@ -0,0 +1,101 @@
+package ju
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+var errorStack atomic.Bool
+
+// SetErrorStack 设置 LogError, LogErrorTrace, LogFail 等错误函数是否记录完整的调用栈，缺省是 false。
+// 调用栈保存在 LogInfo.Stack 中，如果 err 是用 %w 包装的错误，调用栈之前还有被包装的错误链。
+// 只需要记录某一处的调用栈时，使用 LogErrorStack 或者 LogEntry.WithStack
+// noinspection GoUnusedExportedFunction
+func SetErrorStack(enable bool) {
+	errorStack.Store(enable)
+}
+
+// LogErrorStack 和 LogFail 相同，但是总是记录完整的调用栈和错误链，不受 SetErrorStack 的影响
+// noinspection GoUnusedExportedFunction
+func LogErrorStack(err error) bool {
+	if err != nil {
+		std().logStack(3, true, err, LevelError, ColorRed, "", nil, err.Error())
+		return true
+	}
+	return false
+}
+
+// LogErrorStackTo 和 LogErrorTraceTo 相同，但是总是记录完整的调用栈和错误链
+// noinspection GoUnusedExportedFunction
+func LogErrorStackTo(tag string, err error, skip int) bool {
+	if err != nil {
+		std().logStack(skip+3, true, err, LevelError, ColorRed, tag, nil, err.Error())
+		return true
+	}
+	return false
+}
+
+// logError 是错误函数的实现，SetErrorStack 开启时记录调用栈，skip 的含义和 logColor 相同
+func logError(skip int, tag string, err error) {
+	std().logStack(skip+1, errorStack.Load(), err, LevelError, ColorRed, tag, nil, err.Error())
+}
+
+// WithStack 返回一个记录完整调用栈的 LogEntry
+func (e *LogEntry) WithStack() *LogEntry {
+	ne := e.clone(0)
+	ne.stack = true
+	return ne
+}
+
+// captureStack 返回调用栈，第一层是 GetTrace(skip) 的位置，每层是 "函数名\n\t文件:行号" 的形式。
+// err 有包装的错误时，前面是 "caused by: 错误" 形式的错误链，errors.Join 的错误会缩进显示
+func captureStack(skip int, err error) string {
+	var builder strings.Builder
+	if err != nil {
+		writeErrorChain(&builder, err, 0)
+	}
+	//runtime.Callers 的 1 是 captureStack，比 GetTrace 多一层
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			fmt.Fprintf(&builder, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// writeErrorChain 写入 err 包装的错误，err 本身已经是日志的内容，所以不写入
+func writeErrorChain(builder *strings.Builder, err error, depth int) {
+	var wrapped []error
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		wrapped = e.Unwrap()
+	default:
+		if w := errors.Unwrap(err); w != nil {
+			wrapped = []error{w}
+		}
+	}
+	//errors.Join 等包装多个错误时，被包装的错误缩进一层
+	if len(wrapped) > 1 {
+		depth++
+	}
+	for _, w := range wrapped {
+		if w == nil {
+			continue
+		}
+		builder.WriteString(strings.Repeat("  ", depth))
+		builder.WriteString("caused by: ")
+		builder.WriteString(strings.ReplaceAll(w.Error(), "\n", "; "))
+		builder.WriteString("\n")
+		writeErrorChain(builder, w, depth)
+	}
+}
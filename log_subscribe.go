@@ -0,0 +1,86 @@
+package ju
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type logSubscriber struct {
+	filter *LogQuery
+	ch     chan *LogInfo
+}
+
+var logSubscribers = struct {
+	mu    sync.RWMutex
+	count atomic.Int32
+	list  map[*logSubscriber]struct{}
+}{list: map[*logSubscriber]struct{}{}}
+
+// SubscribeLogs 订阅之后记录的日志，返回接收日志的通道和取消订阅的函数，取消订阅后通道会被关闭。
+// filter 使用 LogQuery 的 Tags, Levels, Colors, Trace, Text 条件，Since, Until, Limit, Cursor 被忽略，filter 为 nil 时接收全部日志。
+// 日志的发送不会阻塞 Log 函数，如果接收方处理不及时，通道满了（缓冲 bufSize 条，缺省 256 条）以后的日志会被丢弃。
+// 收到的 LogInfo 和其它订阅者以及日志存储共用，不能修改。
+// 订阅只接收 Log 类函数产生的日志，它和 SetLogParam 的设置无关，不需要设置日志存储，也不受 output 的影响。
+// noinspection GoUnusedExportedFunction
+func SubscribeLogs(filter *LogQuery, bufSize int) (<-chan *LogInfo, func()) {
+	if bufSize <= 0 {
+		bufSize = 256
+	}
+	sub := &logSubscriber{ch: make(chan *LogInfo, bufSize)}
+	if filter != nil {
+		sub.filter = &LogQuery{Tags: filter.Tags, Levels: filter.Levels, Colors: filter.Colors, Trace: filter.Trace, Text: filter.Text}
+	}
+	logSubscribers.mu.Lock()
+	logSubscribers.list[sub] = struct{}{}
+	logSubscribers.count.Store(int32(len(logSubscribers.list)))
+	logSubscribers.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			logSubscribers.mu.Lock()
+			delete(logSubscribers.list, sub)
+			logSubscribers.count.Store(int32(len(logSubscribers.list)))
+			logSubscribers.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+	return sub.ch, cancel
+}
+
+// publishLog 把日志发送给所有订阅者
+func publishLog(li *LogInfo) {
+	if logSubscribers.count.Load() == 0 {
+		return
+	}
+	logSubscribers.mu.RLock()
+	defer logSubscribers.mu.RUnlock()
+	for sub := range logSubscribers.list {
+		if !sub.accept(li) {
+			continue
+		}
+		select {
+		case sub.ch <- li:
+		default:
+		}
+	}
+}
+func (sub *logSubscriber) accept(li *LogInfo) bool {
+	f := sub.filter
+	if f == nil {
+		return true
+	}
+	if len(f.Tags) > 0 {
+		found := false
+		for _, tag := range f.Tags {
+			if tag == li.Tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.match(li)
+}
@@ -0,0 +1,327 @@
+// Package logview 提供一个浏览日志的 http.Handler，它可以使用 ju.FileLogDb, ju.SqliteLogDb, ju.MysqlLogDb, ju.PostgresLogDb 或者任何 ju.LogStore。
+//
+// 页面可以按 tag 浏览日志，按级别、颜色、时间、trace 和内容过滤，实时显示新日志，以及清空和删除日志。
+//
+//	http.Handle("/logs/", http.StripPrefix("/logs", logview.New(db, &logview.Option{Auth: auth})))
+//
+// 页面使用相对路径访问接口，所以挂载的路径需要以 "/" 结尾。
+package logview
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsuserapp/ju"
+)
+
+// Action 是请求的操作类型，Auth 根据它决定是否允许请求
+type Action int
+
+const (
+	// ActionView 浏览页面、查询日志和实时日志
+	ActionView Action = iota
+	// ActionDelete 清空和删除日志
+	ActionDelete
+)
+
+func (a Action) String() string {
+	if a == ActionDelete {
+		return "delete"
+	}
+	return "view"
+}
+
+// Option 是日志页面的设置，nil 使用缺省设置
+type Option struct {
+	// Auth 检查请求是否允许执行 action，返回 false 时请求返回 403。
+	// Auth 为 nil 时只允许浏览，清空和删除日志总是被拒绝。
+	// 清空和删除日志只接受同源页面的 POST 请求，其它网站的页面提交的请求在检查 Auth 之前就被拒绝
+	Auth func(r *http.Request, action Action) bool
+	// Title 页面标题，缺省是 "Logs"
+	Title string
+	// PageSize 每次加载的日志条数，缺省值是 100
+	PageSize int
+	// Heartbeat 实时日志连接的心跳间隔，用来防止代理断开空闲连接，缺省值是 15 秒
+	Heartbeat time.Duration
+}
+
+type handler struct {
+	store ju.LogStore
+	opt   Option
+}
+
+// New 创建日志页面的 http.Handler。
+// 实时日志使用 ju.SubscribeLogs，所以只能看到当前进程记录的日志，和 store 无关。
+// noinspection GoUnusedExportedFunction
+func New(store ju.LogStore, opt *Option) http.Handler {
+	h := &handler{store: store}
+	if opt != nil {
+		h.opt = *opt
+	}
+	if h.opt.Title == "" {
+		h.opt.Title = "Logs"
+	}
+	if h.opt.PageSize <= 0 {
+		h.opt.PageSize = 100
+	}
+	if h.opt.Heartbeat <= 0 {
+		h.opt.Heartbeat = 15 * time.Second
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//按后缀匹配，这样使用或者不使用 http.StripPrefix 都可以
+	path := r.URL.Path
+	action := ActionView
+	var serve func(w http.ResponseWriter, r *http.Request)
+	switch {
+	case strings.HasSuffix(path, "/api/tags"):
+		serve = h.serveTags
+	case strings.HasSuffix(path, "/api/logs"):
+		serve = h.serveLogs
+	case strings.HasSuffix(path, "/api/tail"):
+		serve = h.serveTail
+	case strings.HasSuffix(path, "/api/clear"):
+		action, serve = ActionDelete, h.serveClear
+	case strings.HasSuffix(path, "/api/delete"):
+		action, serve = ActionDelete, h.serveDelete
+	case path == "" || strings.HasSuffix(path, "/"):
+		serve = h.servePage
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if action == ActionDelete && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if action == ActionDelete && !sameOrigin(r) {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+	if !h.allow(r, action) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	serve(w, r)
+}
+
+// sameOrigin 判断请求是否来自同源的页面，防止其它网站利用浏览器中的 cookie 提交清空和删除请求（CSRF）。
+// 浏览器会发送 Sec-Fetch-Site 或者 Origin，两者都没有时不是浏览器发出的跨站请求，比如 curl
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+func (h *handler) allow(r *http.Request, action Action) bool {
+	if h.opt.Auth == nil {
+		return action == ActionView
+	}
+	return h.opt.Auth(r, action)
+}
+
+func (h *handler) servePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := pageTemplate.Execute(w, map[string]any{
+		"Title":     h.opt.Title,
+		"PageSize":  h.opt.PageSize,
+		"CanDelete": h.allow(r, ActionDelete),
+	})
+	ju.OutputErrorTrace(err, 0)
+}
+
+func (h *handler) serveTags(w http.ResponseWriter, _ *http.Request) {
+	tags := h.store.GetTags()
+	if tags == nil {
+		tags = []string{}
+	}
+	writeJson(w, tags)
+}
+
+// serveLogs 查询日志，参数见 parseQuery，返回 {"logs": [...], "next": "cursor"}，没有更多日志时 next 是空串
+func (h *handler) serveLogs(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = h.opt.PageSize
+	}
+	logs, next := h.store.QueryLogs(q)
+	if logs == nil {
+		logs = []*ju.LogInfo{}
+	}
+	writeJson(w, map[string]any{"logs": logs, "next": formatCursor(next)})
+}
+
+// serveTail 使用 Server-Sent Events 发送新日志，每条日志是一个 data 为 LogInfo json 的消息
+func (h *handler) serveTail(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc := http.NewResponseController(w)
+	ch, cancel := ju.SubscribeLogs(q, 0)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if rc.Flush() != nil {
+		return
+	}
+	ticker := time.NewTicker(h.opt.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case li, ok := <-ch:
+			if !ok {
+				return
+			}
+			var data []byte
+			data, err = json.Marshal(li)
+			if err == nil {
+				_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		}
+		if err != nil || rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// serveClear 清空 tag 的日志，没有 tag 参数时清空全部日志
+func (h *handler) serveClear(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("tag") {
+		h.store.ClearLogs()
+		writeJson(w, map[string]any{"count": -1})
+		return
+	}
+	count := h.store.ClearTagLogs(r.URL.Query().Get("tag"))
+	writeJson(w, map[string]any{"count": count})
+}
+
+// serveDelete 有 id 参数时删除 tag 中这条日志，否则删除 tag（没有 tag 参数时是所有 tag）中 created_at <= before 的日志
+func (h *handler) serveDelete(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tag := query.Get("tag")
+	if query.Has("id") {
+		id, err := strconv.ParseInt(query.Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		h.store.DeleteLog(tag, id)
+		writeJson(w, map[string]any{"count": 1})
+		return
+	}
+	before := query.Get("before")
+	if before == "" {
+		http.Error(w, "missing before", http.StatusBadRequest)
+		return
+	}
+	var count int64
+	if query.Has("tag") {
+		count = h.store.DeleteTagLogs(tag, before)
+	} else {
+		count = h.store.DeleteLogs(before)
+	}
+	writeJson(w, map[string]any{"count": count})
+}
+
+// parseQuery 从 url 参数生成查询条件：
+// tag 可以有多个，tag= 表示缺省日志，没有 tag 参数时查询所有 tag；
+// level 和 color 可以有多个，也可以用逗号分隔；since, until, trace, text, app, limit 对应 LogQuery 的字段；
+// cursor 是上一次查询返回的 next
+func parseQuery(r *http.Request) (*ju.LogQuery, error) {
+	query := r.URL.Query()
+	q := &ju.LogQuery{
+		Tags:   query["tag"],
+		Since:  query.Get("since"),
+		Until:  query.Get("until"),
+		Trace:  query.Get("trace"),
+		Text:   query.Get("text"),
+		App:    query.Get("app"),
+		Colors: splitValues(query["color"]),
+	}
+	for _, name := range splitValues(query["level"]) {
+		level, ok := ju.ParseLogLevel(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid level: %s", name)
+		}
+		q.Levels = append(q.Levels, level)
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit: %s", s)
+		}
+		q.Limit = limit
+	}
+	if s := query.Get("cursor"); s != "" {
+		cursor, ok := parseCursor(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid cursor: %s", s)
+		}
+		q.Cursor = cursor
+	}
+	return q, nil
+}
+
+func splitValues(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// formatCursor 把 cursor 转换为 "created_at,id" 的形式，nil 返回空串
+func formatCursor(c *ju.LogCursor) string {
+	if c == nil {
+		return ""
+	}
+	return c.CreatedAt + "," + strconv.FormatInt(c.Id, 10)
+}
+func parseCursor(s string) (*ju.LogCursor, bool) {
+	i := strings.LastIndexByte(s, ',')
+	if i == -1 {
+		return nil, false
+	}
+	id, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &ju.LogCursor{CreatedAt: s[:i], Id: id}, true
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	err := json.NewEncoder(w).Encode(v)
+	ju.OutputErrorTrace(err, 0)
+}
@@ -0,0 +1,124 @@
+package logview
+
+import "html/template"
+
+// pageTemplate 是日志页面，所有数据通过 api 加载，页面本身不包含日志内容
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{margin:0;font:13px/1.4 Menlo,Consolas,monospace;background:#1e1e1e;color:#ddd;display:flex;height:100vh}
+#side{width:180px;border-right:1px solid #333;overflow:auto;flex-shrink:0}
+#side div{padding:4px 10px;cursor:pointer;white-space:nowrap;overflow:hidden;text-overflow:ellipsis}
+#side div:hover{background:#2a2a2a}
+#side div.on{background:#094771}
+#main{flex:1;display:flex;flex-direction:column;min-width:0}
+#bar{padding:6px;border-bottom:1px solid #333;display:flex;flex-wrap:wrap;gap:4px;align-items:center}
+#bar input,#bar select,#bar button{font:inherit;background:#2a2a2a;color:#ddd;border:1px solid #444;padding:2px 4px}
+#list{flex:1;overflow:auto}
+table{border-collapse:collapse;width:100%}
+td{padding:2px 6px;vertical-align:top;border-bottom:1px solid #2a2a2a}
+td.t{white-space:nowrap;color:#888}
+td.l{white-space:pre-wrap;word-break:break-all}
+td.f{color:#888;font-size:12px}
+tr:hover td{background:#262626}
+#more{margin:8px;display:none}
+.red{color:#f14c4c}.green{color:#23d18b}.yellow{color:#f5f543}.blue{color:#3b8eea}
+.magenta{color:#d670d6}.cyan{color:#29b8db}.gray{color:#888}.white{color:#fff}.black{color:#666}
+</style>
+</head>
+<body>
+<div id="side"></div>
+<div id="main">
+<div id="bar">
+<select id="level"><option value="">all levels</option><option>trace</option><option>debug</option>
+<option>info</option><option>warn</option><option>error</option><option>fatal</option></select>
+<select id="color"><option value="">all colors</option><option>red</option><option>green</option>
+<option>yellow</option><option>blue</option><option>magenta</option><option>cyan</option><option>gray</option>
+<option>white</option><option>black</option></select>
+<input id="since" placeholder="since" size="19"><input id="until" placeholder="until" size="19">
+<input id="trace" placeholder="trace" size="12"><input id="text" placeholder="text" size="16"><input id="app" placeholder="app" size="10">
+<button id="search">search</button>
+<label><input type="checkbox" id="live">live</label>
+{{if .CanDelete}}<button id="delete">delete before until</button><button id="clear">clear tag</button>{{end}}
+</div>
+<div id="list"><table><tbody id="rows"></tbody></table><button id="more">more</button></div>
+</div>
+<script>
+(function(){
+var pageSize={{.PageSize}}, tag=null, next="", source=null;
+function $(id){return document.getElementById(id)}
+function params(){
+	var p=new URLSearchParams();
+	if(tag!==null)p.append("tag",tag);
+	["level","color","since","until","trace","text","app"].forEach(function(k){var v=$(k).value.trim();if(v)p.append(k,v)});
+	return p;
+}
+function row(li,top){
+	var tr=document.createElement("tr");
+	function td(cls,text){var d=document.createElement("td");d.className=cls;d.textContent=text;tr.appendChild(d);return d}
+	td("t",li.created_at);
+	td("t",li.tag);
+	td("t "+(li.color||""),li.level);
+	td("l "+(li.color||""),li.log).title=(li.app?li.app+"@"+li.host+":"+li.pid+" ":"")+li.trace+(li.stack?"\n"+li.stack:"");
+	td("f",li.fields?Object.keys(li.fields).sort().map(function(k){return k+"="+JSON.stringify(li.fields[k])}).join(" "):"");
+	var rows=$("rows");
+	if(top)rows.insertBefore(tr,rows.firstChild);else rows.appendChild(tr);
+}
+function load(more){
+	var p=params();
+	p.set("limit",pageSize);
+	if(more)p.set("cursor",next);else $("rows").textContent="";
+	fetch("api/logs?"+p).then(function(r){if(!r.ok)throw new Error(r.status+" "+r.statusText);return r.json()}).then(function(d){
+		d.logs.forEach(function(li){row(li,false)});
+		next=d.next;
+		$("more").style.display=next?"block":"none";
+	}).catch(function(e){alert(e.message)});
+}
+function tags(){
+	fetch("api/tags").then(function(r){return r.json()}).then(function(list){
+		var side=$("side");side.textContent="";
+		[null].concat(list).forEach(function(t){
+			var d=document.createElement("div");
+			d.textContent=t===null?"(all)":t===""?"(default)":t;
+			if(t===tag)d.className="on";
+			d.onclick=function(){tag=t;tags();search()};
+			side.appendChild(d);
+		});
+	});
+}
+function live(){
+	if(source){source.close();source=null}
+	if(!$("live").checked)return;
+	var p=params();p.delete("since");p.delete("until");
+	source=new EventSource("api/tail?"+p);
+	source.onmessage=function(e){row(JSON.parse(e.data),true)};
+}
+function search(){load(false);live()}
+function post(url,msg){
+	if(!confirm(msg))return;
+	fetch(url,{method:"POST"}).then(function(r){if(!r.ok)throw new Error(r.status+" "+r.statusText);return r.json()}).then(function(){tags();search()}).catch(function(e){alert(e.message)});
+}
+$("search").onclick=search;
+$("live").onchange=live;
+$("more").onclick=function(){load(true)};
+["since","until","trace","text","app"].forEach(function(k){$(k).onkeydown=function(e){if(e.key==="Enter")search()}});
+if($("clear"))$("clear").onclick=function(){
+	var p=new URLSearchParams();if(tag!==null)p.set("tag",tag);
+	post("api/clear?"+p,tag===null?"clear all logs?":"clear logs of tag \""+tag+"\"?");
+};
+if($("delete"))$("delete").onclick=function(){
+	var before=$("until").value.trim();
+	if(!before){alert("input the time in until");return}
+	var p=new URLSearchParams();if(tag!==null)p.set("tag",tag);p.set("before",before);
+	post("api/delete?"+p,"delete logs before "+before+"?");
+};
+tags();search();
+})();
+</script>
+</body>
+</html>
+`))